@@ -1,8 +1,12 @@
 package backoff
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cenkalti/backoff"
@@ -11,16 +15,151 @@ import (
 
 var ErrShutdown = errors.New("TokenRefresher closing")
 
+var ErrRunning = errors.New("TokenRefresher already running")
+
 type TokenRefresher interface {
 	GetToken() (string, error)
-	Refresh()
+	Token() (Token, error)
+	Status() Status
+	Refresh(reason string)
+	SetRetriever(retriever TokenRetriever)
 	Close() error
+	CloseContext(ctx context.Context) error
+
+	// unwrap returns the refresher created by this package that the
+	// TokenRefresher is or embeds, so that WithParent can follow it.
+	unwrap() *tokenRefresher
+}
+
+// RunnableTokenRefresher is a TokenRefresher whose refresher goroutine is run
+// by its owner, e.g. in an errgroup or under a supervisor.
+type RunnableTokenRefresher interface {
+	TokenRefresher
+
+	// Run retrieves the first token and keeps it refreshed until ctx is done
+	// or the refresher is closed. It blocks until shutdown is complete, as
+	// with CloseContext, then returns nil. It returns ErrRunning if the
+	// refresher has already been run, or ErrShutdown if it has been closed.
+	Run(ctx context.Context) error
 }
 
 type TokenRetriever interface {
 	RetrieveToken() (token string, expiresIn time.Duration, err error)
 }
 
+// ContextRetriever is implemented by TokenRetrievers that support cancellation
+// or can report metadata about the tokens they return. The refresher prefers
+// RetrieveTokenContext over RetrieveToken, and cancels ctx when it is closed.
+// The returned Token must have Value and Expiry set; Stale is ignored.
+type ContextRetriever interface {
+	TokenRetriever
+	RetrieveTokenContext(ctx context.Context) (Token, error)
+}
+
+// Token is a token along with metadata about it.
+type Token struct {
+	Value string
+
+	// Expiry is the absolute time the token expires, as reported by the
+	// retriever when it was retrieved.
+	Expiry time.Time
+
+	// Stale reports whether the token is being served after a failed refresh.
+	Stale bool
+
+	// Source names where the token came from, if the retriever reports it.
+	Source string
+
+	// Type and Scope are the token type, e.g. "Bearer", and the space
+	// separated scopes granted, if the retriever reports them.
+	Type  string
+	Scope string
+
+	// Claims are the decoded claims of a JWT token, if the retriever reports
+	// them. They must not be modified.
+	Claims map[string]interface{}
+}
+
+// Status describes the state of a refresher, for diagnostics.
+type Status struct {
+	// Expiry is the expiry of the stored token, or zero if there is none.
+	Expiry time.Time
+
+	// Stale reports whether the stored token is being served after a failed
+	// refresh.
+	Stale bool
+
+	// LastRefresh is when a token was last successfully retrieved.
+	LastRefresh time.Time
+
+	// LastError is the most recent retrieval error, which may predate
+	// LastRefresh.
+	LastError error
+
+	// Panics counts retrieval attempts that failed because the retriever
+	// panicked.
+	Panics int
+
+	// Restarts counts restarts of the refresher goroutine after it panicked.
+	Restarts int
+
+	// Reason is why the latest refresh was started: "startup", "scheduled",
+	// or the reason passed to Refresh.
+	Reason string
+}
+
+// Hooks are optional callbacks invoked by the refresher goroutine. They are
+// called synchronously and should not block.
+type Hooks struct {
+	// OnRefresh is called after a token has been successfully retrieved.
+	OnRefresh func(token string, expiresIn time.Duration)
+
+	// OnError is called after every failed retrieval. permanent reports
+	// whether the error stopped the refresher from retrying.
+	OnError func(err error, permanent bool)
+}
+
+// Option configures optional behavior of a tokenRefresher.
+type Option func(*tokenRefresher)
+
+// WithErrorClassifier sets the ErrorClassifier used to decide whether a
+// retrieval error is permanent. It defaults to IsPermanent.
+func WithErrorClassifier(classifier ErrorClassifier) Option {
+	return func(m *tokenRefresher) {
+		m.classifier = classifier
+	}
+}
+
+// WithServeStale enables stale-while-revalidate: when a timed refresh can't
+// get a new token within the refresh buffer, the old token keeps being served,
+// flagged as stale, until its absolute expiry plus grace, while the refresher
+// keeps retrying. By default the token is locked as soon as the refresh buffer
+// runs out.
+func WithServeStale(grace time.Duration) Option {
+	return func(m *tokenRefresher) {
+		m.serveStale = true
+		m.staleGrace = grace
+	}
+}
+
+// WithAttemptTimeout limits each call to the retriever to timeout. A call
+// that hangs is abandoned, or cancelled if the retriever implements
+// ContextRetriever, and treated as a failed attempt so that backoff continues.
+// Without it, a hung call blocks refreshes forever, and GetToken too during a
+// forced refresh.
+func WithAttemptTimeout(timeout time.Duration) Option {
+	return func(m *tokenRefresher) {
+		m.attemptTimeout = timeout
+	}
+}
+
+// WithHooks sets the callbacks invoked as the refresher works.
+func WithHooks(hooks Hooks) Option {
+	return func(m *tokenRefresher) {
+		m.hooks = hooks
+	}
+}
+
 // tokenRefresher manages refreshing tokens with an exponential backoff
 // strategy until the token is expired, then switches to a constant
 // backoff strategy.
@@ -30,100 +169,321 @@ type tokenRefresher struct {
 	logger        log15.Logger
 	retriever     TokenRetriever
 	refreshBuffer time.Duration
+	classifier    ErrorClassifier
+	hooks         Hooks
+	retryJitter   Jitter
+	refreshJitter float64
+
+	refreshFraction float64
+	minBuffer       time.Duration
+	maxBuffer       time.Duration
+	buffer          time.Duration // Effective refresh buffer of the current token.
+
+	randOnce sync.Once
+	rand     *lockedRand
+
+	restarts *backoff.ExponentialBackOff // Only used by the refresher goroutine.
 
 	closeOnce sync.Once
+	closeMu   sync.Mutex // Serializes closing done with Run starting.
 	done      chan struct{}
 	force     chan struct{}
+	rotated   chan struct{}  // Signals that the parent rotated its token.
+	running   sync.WaitGroup // Counts the refresher goroutine and retrievals.
+	started   atomic.Bool
+
+	retrieverMu sync.Mutex
+
+	serveStale bool
+	staleGrace time.Duration
+
+	attemptTimeout time.Duration
+
+	onDemand *onDemand // Only set for lazy refreshers.
+
+	parent      *tokenRefresher
+	derivedFrom atomic.Uint64 // Parent generation the latest retrieval started from.
+	requested   atomic.Uint64 // Parent generation a new token was last requested for.
+	childrenMu  sync.Mutex
+	children    []*tokenRefresher
+
+	mu    sync.Mutex // Serializes writers of state.
+	state atomic.Pointer[tokenState]
+
+	statusMu    sync.Mutex
+	status      Status
+	forceReason string
+}
+
+// NewTokenRefresher creates a new tokenRefresher, applying any options on top
+// of the defaults, and starts refreshing tokens in the background.
+func NewTokenRefresher(logger log15.Logger, refreshBuffer time.Duration, retriever TokenRetriever, opts ...Option) TokenRefresher {
+	m := NewRunnableTokenRefresher(logger, refreshBuffer, retriever, opts...).(*tokenRefresher)
+	m.started.Store(true)
+	m.attach()
+	m.running.Add(1) // Added before starting, so that CloseContext waits for it.
+	go m.run(context.Background())
 
-	mu    sync.RWMutex
-	token string
+	return m
 }
 
-// NewTokenRefresher creates a new default tokenRefresher.
-func NewTokenRefresher(logger log15.Logger, refreshBuffer time.Duration, retriever TokenRetriever) TokenRefresher {
+// NewRunnableTokenRefresher creates a new tokenRefresher like
+// NewTokenRefresher, but doesn't start it. Nothing is retrieved until Run is
+// called, and GetToken returns an error until then.
+func NewRunnableTokenRefresher(logger log15.Logger, refreshBuffer time.Duration, retriever TokenRetriever, opts ...Option) RunnableTokenRefresher {
 	m := tokenRefresher{
 		logger:        logger,
 		retriever:     retriever,
 		refreshBuffer: refreshBuffer,
 		done:          make(chan struct{}),
 		force:         make(chan struct{}),
+		rotated:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&m)
 	}
-	go m.refresher()
 
 	return &m
 }
 
+// Run implements RunnableTokenRefresher. The refresher runs on the calling
+// goroutine, except while it restarts after a panic.
+func (m *tokenRefresher) Run(ctx context.Context) error {
+	if !m.started.CompareAndSwap(false, true) {
+		return ErrRunning
+	}
+
+	// Checked under closeMu, so that once Close has returned, CloseContext
+	// either waits for the refresher or it never starts.
+	m.closeMu.Lock()
+	select {
+	case <-m.done:
+		m.closeMu.Unlock()
+		return ErrShutdown
+	default:
+	}
+	m.attach()
+	m.running.Add(1)
+	m.closeMu.Unlock()
+	return m.run(ctx)
+}
+
+// run runs the refresher until ctx is done or the refresher is closed, then
+// waits for shutdown to complete. The caller must have added the refresher
+// to running.
+func (m *tokenRefresher) run(ctx context.Context) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			m.Close()
+		case <-stop:
+		}
+	}()
+
+	func() {
+		defer m.running.Done()
+		m.refresher()
+	}()
+
+	// The refresher returns early if it is restarting after a panic.
+	<-m.done
+	m.running.Wait()
+	return nil
+}
+
 // GetToken returns the stored token. If the token is invalid or expired and
-// in the process of being refreshed, GetToken will block.
+// in the process of being refreshed, GetToken will block. If the last refresh
+// failed with a permanent error, that error is returned.
 func (m *tokenRefresher) GetToken() (token string, err error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	t, err := m.Token()
+	return t.Value, err
+}
+
+// Token returns the stored token along with its metadata. It blocks and fails
+// in the same cases as GetToken. A stale token is returned until it expires
+// plus the stale grace period, after which it is treated as expired. A token
+// derived from a revoked parent token is refused with ErrParentRevoked.
+//
+// Token never takes a lock: it reads an immutable snapshot of the token state,
+// and only waits if the snapshot says a refresh is locking the token.
+func (m *tokenRefresher) Token() (Token, error) {
+	m.checkParent()
+	if m.onDemand != nil {
+		m.refreshOnDemand()
+	}
+
+	s := m.settled()
 
-	if m.token == "" {
+	if s.token != "" && s.stale && time.Now().After(s.expiry.Add(m.staleGrace)) {
+		return Token{}, errors.New("Token is invalid or expired")
+	}
+	if s.token == "" {
+		if s.err != nil {
+			return Token{}, s.err
+		}
 		// This error is only returned when explicit cancellation occurs
 		// due to service shutdown.
-		err = errors.New("Token is invalid or expired")
+		return Token{}, errors.New("Token is invalid or expired")
+	}
+	if m.revoked(s) {
+		return Token{}, ErrParentRevoked
 	}
-	return m.token, err
+	return Token{Value: s.token, Expiry: s.expiry, Stale: s.stale, Source: s.source, Type: s.tokenType, Scope: s.scope, Claims: s.claims}, nil
 }
 
-// Refresh requests the refresher goroutine update the token. If the refresher
-// is currently updating the token, this is a no-op.
-func (m *tokenRefresher) Refresh() {
+// Status returns a snapshot of the refresher's state. Unlike GetToken it never
+// blocks.
+func (m *tokenRefresher) Status() Status {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+	return m.status
+}
+
+// Refresh requests the refresher goroutine update the token, e.g. because a
+// caller has evidence that the token was rejected. reason is recorded in the
+// Status and logs. If the refresher is waiting to retry a failed attempt, it
+// attempts immediately. If it is in the middle of an attempt, this is a no-op.
+// A lazy refresher instead refreshes on the next call to GetToken.
+func (m *tokenRefresher) Refresh(reason string) {
+	m.statusMu.Lock()
+	m.forceReason = reason
+	m.statusMu.Unlock()
+
+	if m.onDemand != nil {
+		m.onDemand.mu.Lock()
+		m.onDemand.forced = true
+		m.onDemand.mu.Unlock()
+	}
+
 	select {
 	case m.force <- struct{}{}:
 	default:
 	}
 }
 
+// SetRetriever replaces the retriever used for subsequent refreshes and
+// requests a refresh with it. This is how a refresher stopped by a permanent
+// error can be pointed at corrected credentials.
+func (m *tokenRefresher) SetRetriever(retriever TokenRetriever) {
+	m.retrieverMu.Lock()
+	m.retriever = retriever
+	m.retrieverMu.Unlock()
+
+	m.Refresh("retriever changed")
+}
+
 // Close closes the done chan, signaling service shutdown. It can be called
-// more than once.
+// more than once. It doesn't wait for shutdown to complete; use CloseContext
+// for that.
 func (m *tokenRefresher) Close() error {
 	m.closeOnce.Do(func() {
+		m.closeMu.Lock()
 		close(m.done)
+		m.closeMu.Unlock()
+		m.detach()
 	})
 	return nil
 }
 
+// CloseContext signals service shutdown like Close, then waits for the
+// refresher goroutine and any retrievals in flight, including ones abandoned
+// by the attempt timeout, to finish. Once it returns nil, the retriever won't
+// be called again. If ctx is done first, an error wrapping ctx.Err() is
+// returned; shutdown carries on in the background and CloseContext can be
+// called again to keep waiting.
+func (m *tokenRefresher) CloseContext(ctx context.Context) error {
+	m.Close()
+	if o := m.onDemand; o != nil {
+		// Refreshes on demand are added to running under o.mu once they've
+		// checked done, so after this no more can start.
+		o.mu.Lock()
+		o.mu.Unlock()
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("TokenRefresher did not shut down: %w", ctx.Err())
+	}
+}
+
 // refresher initiates a refresh in the following three cases:
 // 1) On service startup
 // 2) When the existing token is about to expire
 // 3) When Refresh() is called
+//
+// If a refresh fails with a permanent error, no further timed refreshes are
+// scheduled until Refresh() is called.
+//
+// Panics in the retriever are recovered as failed attempts. If the refresher
+// itself panics, e.g. in a hook, it is restarted after an exponentially
+// increasing delay, which resets once a refresh succeeds.
 func (m *tokenRefresher) refresher() {
 	defer func() {
 		if r := recover(); r != nil {
-			m.logger.Crit("Panic occurred in refresher goroutine. Restarting", "err", r)
-			go m.refresher()
+			m.statusMu.Lock()
+			m.status.Restarts++
+			m.statusMu.Unlock()
+
+			d := m.restartBackOff().NextBackOff()
+			m.logger.Crit("Panic occurred in refresher goroutine. Restarting", "err", r, "delay", d, "stack", string(debug.Stack()))
+			m.running.Add(1)
+			go func() {
+				defer m.running.Done()
+				timer := time.NewTimer(d)
+				defer timer.Stop()
+				select {
+				case <-timer.C:
+					m.refresher()
+				case <-m.done:
+				}
+			}()
 		}
 	}()
 
+	m.setReason("startup")
 	expWithBuffer, err := m.refresh(true)
 	if err == ErrShutdown {
 		return
 	}
+	if err == nil {
+		m.restartBackOff().Reset()
+	}
 	timer := time.NewTimer(expWithBuffer)
 	defer timer.Stop()
+	schedule(timer, m.spread(expWithBuffer), err)
 
 	for {
 		select {
 		case <-timer.C:
+			m.setReason("scheduled")
 			expWithBuffer, err := m.refresh(false)
 			if err == ErrShutdown {
 				return
 			}
-			timer.Reset(expWithBuffer)
+			schedule(timer, m.spread(expWithBuffer), err)
 
 		case <-m.force:
+			m.logger.Info("Forced refresh", "reason", m.forced())
 			expWithBuffer, err := m.refresh(true)
 			if err == ErrShutdown {
 				return
 			}
-			if !timer.Stop() {
-				// If the timer hasn't been hit, we need to drain the timer chan
-				// before we reset it.
-				<-timer.C
+			schedule(timer, m.spread(expWithBuffer), err)
+
+		case <-m.rotated:
+			if expWithBuffer, ok := m.rederive(); ok {
+				schedule(timer, m.spread(expWithBuffer), nil)
 			}
-			timer.Reset(expWithBuffer)
 
 		case <-m.done:
 			return
@@ -137,49 +497,95 @@ func (m *tokenRefresher) refresher() {
 // occurred, and once the refresh buffer has elapsed in a normal timed refresh.
 //
 // Tokens are initially attempted to be refreshed with an exponential backoff
-// strategy, which continues for refreshBuffer amount of time or until the refresh
-// is successful. After refreshBuffer has elapsed, a constant backoff strategy
-// is used until the refresh is successful.
+// strategy, which continues for the refresh buffer of the current token or
+// until the refresh is successful. After the refresh buffer has elapsed, a
+// constant backoff strategy is used until the refresh is successful.
 //
 // refresh supports explicit cancellation during shutdown. Note that if shutdown
 // occurs and the token was invalid, the token will be unlocked and will remain
 // set to an empty string, causing GetToken to return an error.
+//
+// If the retriever returns a permanent error, retrying stops immediately: the
+// token is cleared, the error is stored for GetToken and returned.
+//
+// If serving stale tokens is enabled, a timed refresh that runs out of refresh
+// buffer leaves the token in place, marked stale, rather than locking it.
 func (m *tokenRefresher) refresh(force bool) (expiresIn time.Duration, err error) {
-	var token string
+	locked := false
+	lock := func() {
+		if !locked {
+			m.lock()
+			locked = true
+		}
+	}
+	defer func() {
+		if locked {
+			m.unlock()
+		}
+	}()
+
+	var token Token
 	if force {
-		m.mu.Lock()
-		defer m.mu.Unlock()
+		lock()
+		m.revoke()
 
-		token, expiresIn, err = m.retriever.RetrieveToken()
-		m.setToken(token)
+		token, expiresIn, err = m.retrieve(m.done)
 		if err == nil {
-			return expiresIn - m.refreshBuffer, nil
+			m.setToken(token, expiresIn)
+			m.onRefresh(token.Value, expiresIn)
+			return m.nextRefresh(expiresIn), nil
+		}
+		m.expire()
+		if m.isPermanent(err) {
+			return 0, m.fail(err)
 		}
+		m.onError(err, false)
 		m.logger.Crit("Force refresh failed", "err", err)
+		if _, err := m.wait(err, m.done); err != nil {
+			return 0, ErrShutdown
+		}
 	}
 
-	eb := backoff.NewExponentialBackOff()
-	eb.MaxElapsedTime = m.refreshBuffer - time.Second // Prevent a race condition between the token expiring and acquiring the lock.
+	eb := m.exponentialBackOff(m.currentBuffer() - time.Second) // Prevent a race condition between the token expiring and acquiring the lock.
 	token, expiresIn, err = m.refreshInner(eb, m.done)
 	if err != nil {
 		if err == ErrShutdown {
 			return 0, err
 		}
+		if m.isPermanent(err) {
+			lock()
+			return 0, m.fail(err)
+		}
 		if !force {
-			m.mu.Lock()
-			defer m.mu.Unlock()
-			m.setToken(token)
-			m.logger.Crit("Could not refresh token within refresh buffer. Stored token is now expired", "err", err)
+			if m.serveStale {
+				m.markStale()
+				m.logger.Crit("Could not refresh token within refresh buffer. Serving stale token", "err", err)
+			} else {
+				lock()
+				m.expire()
+				m.logger.Crit("Could not refresh token within refresh buffer. Stored token is now expired", "err", err)
+			}
+		}
+		if _, err := m.wait(err, m.done); err != nil {
+			return 0, ErrShutdown
 		}
 
-		token, expiresIn, err = m.refreshInner(backoff.NewConstantBackOff(1*time.Minute), m.done) // TODO: Probably want the interval to be configurable
+		token, expiresIn, err = m.refreshInner(m.constantBackOff(1*time.Minute), m.done) // TODO: Probably want the interval to be configurable
 		if err == ErrShutdown {
 			return 0, err
 		}
+		if err != nil {
+			// refreshInner only gives up on a constant backoff when the error
+			// is permanent.
+			lock()
+			return 0, m.fail(err)
+		}
 	}
 
-	m.setToken(token)
-	return expiresIn - m.refreshBuffer, nil
+	lock()
+	m.setToken(token, expiresIn)
+	m.onRefresh(token.Value, expiresIn)
+	return m.nextRefresh(expiresIn), nil
 }
 
 // refreshInner calls the Retriever whenever the backoff ticker ticks. If
@@ -187,36 +593,339 @@ func (m *tokenRefresher) refresh(force bool) (expiresIn time.Duration, err error
 // that the ticker channel will be closed and the last error returned by
 // the Retriever will be returned from this function.
 //
+// refreshInner stops retrying as soon as the Retriever returns a permanent
+// error, and returns that error.
+//
+// If the Retriever returns an error with a Retry-After hint, the next attempt
+// is delayed by at least that long. When the hint would run past the max
+// elapsed time of an exponential strategy, refreshInner waits until the max
+// elapsed time, then returns the error with the rest of the hint so the
+// caller can honor it.
+//
+// A call to Refresh while refreshInner is waiting for the next tick or a
+// Retry-After delay triggers an immediate attempt.
+//
 // refreshInner also supports explicit cancellation via signaling on the
 // done chan.
-func (m *tokenRefresher) refreshInner(b backoff.BackOff, done <-chan struct{}) (token string, expiresIn time.Duration, err error) {
+func (m *tokenRefresher) refreshInner(b backoff.BackOff, done <-chan struct{}) (token Token, expiresIn time.Duration, err error) {
 	ticker := backoff.NewTicker(b)
+	forced := false // Refresh interrupted a Retry-After delay.
 
 Loop:
 	for {
-		select {
-		case _, ok := <-ticker.C:
-			if !ok { // Max elapsed time has been hit (only applies to the exponential backoff strategy).
-				break Loop
+		if !forced {
+			select {
+			case _, ok := <-ticker.C:
+				if !ok { // Max elapsed time has been hit (only applies to the exponential backoff strategy).
+					break Loop
+				}
+			case <-m.force:
+				// Attempt immediately rather than waiting out the backoff. The
+				// ticker is untouched, so the policy resumes if this fails.
+				m.logger.Info("Forced refresh interrupting backoff", "reason", m.forced())
+			case <-done:
+				ticker.Stop()
+				return Token{}, 0, ErrShutdown
+			}
+		}
+		forced = false
+
+		token, expiresIn, rErr := m.retrieve(done)
+		if rErr != nil {
+			err = rErr
+			if m.isPermanent(err) {
+				ticker.Stop()
+				return Token{}, 0, err
 			}
-			token, expiresIn, rErr := m.retriever.RetrieveToken()
-			if rErr != nil {
-				err = rErr
-				m.logger.Error("Failed to refresh token. Retrying...", "err", err)
-				continue
+			m.onError(err, false)
+			m.logger.Error("Failed to refresh token. Retrying...", "err", err)
+			if d, ok := retryAfter(err); ok {
+				delay, rest := err, error(nil)
+				if remaining, ok := remainingBudget(b); ok && d > remaining {
+					// Honor as much of the hint as the phase allows, then
+					// leave the rest for the caller to wait out.
+					delay, rest = RetryAfter(err, remaining), RetryAfter(err, d-remaining)
+				}
+				var wErr error
+				if forced, wErr = m.wait(delay, done); wErr != nil {
+					ticker.Stop()
+					return Token{}, 0, ErrShutdown
+				}
+				if rest != nil && !forced {
+					ticker.Stop()
+					return Token{}, 0, rest
+				}
 			}
+			continue
+		}
 
-			ticker.Stop()
-			return token, expiresIn, nil
+		ticker.Stop()
+		return token, expiresIn, nil
+	}
+	return Token{}, 0, err
+}
+
+// retrieve calls the current retriever. Context aware retrievers are given a
+// context that is cancelled when done is closed.
+//
+// If an attempt timeout is configured, a call that takes longer is abandoned
+// and returns an error wrapping context.DeadlineExceeded, so that it counts as
+// a failed attempt. Context aware retrievers also have their context
+// cancelled.
+func (m *tokenRefresher) retrieve(done <-chan struct{}) (Token, time.Duration, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
 		case <-done:
-			ticker.Stop()
-			return "", 0, ErrShutdown
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if m.parent != nil {
+		m.derivedFrom.Store(m.parent.settled().generation)
+	}
+
+	r := m.getRetriever()
+	m.running.Add(1)
+	if m.attemptTimeout <= 0 {
+		defer m.running.Done()
+		return retrieveContext(ctx, r)
+	}
+
+	// An abandoned call keeps running, so it is only done once it returns.
+	tracked := RetrieverFunc(func(ctx context.Context) (Token, error) {
+		defer m.running.Done()
+		token, _, err := retrieveContext(ctx, r)
+		return token, err
+	})
+	token, err := retrieveTimeout(ctx, tracked, m.attemptTimeout)
+	if err != nil {
+		return Token{}, 0, err
+	}
+	return token, time.Until(token.Expiry), nil
+}
+
+// retrieveContext calls r, preferring RetrieveTokenContext when r implements
+// ContextRetriever, and returns the token along with its lifetime.
+//
+// A panic in r is recovered and returned as a *PanicError.
+func retrieveContext(ctx context.Context, r TokenRetriever) (token Token, expiresIn time.Duration, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			token, expiresIn, err = Token{}, 0, &PanicError{Value: p, Stack: debug.Stack()}
 		}
+	}()
+
+	if cr, ok := r.(ContextRetriever); ok {
+		token, err = cr.RetrieveTokenContext(ctx)
+		if err != nil {
+			return Token{}, 0, err
+		}
+		return token, time.Until(token.Expiry), nil
+	}
+
+	value, expiresIn, err := r.RetrieveToken()
+	if err != nil {
+		return Token{}, 0, err
 	}
-	return "", 0, err
+	return Token{Value: value, Expiry: time.Now().Add(expiresIn)}, expiresIn, nil
 }
 
-// setToken sets the status of the cached token.
-func (m *tokenRefresher) setToken(token string) {
-	m.token = token
+// setToken sets the status of the cached token. It must be called with the
+// lock held.
+func (m *tokenRefresher) setToken(token Token, expiresIn time.Duration) {
+	now := time.Now()
+	expiry := now.Add(expiresIn)
+	m.update(func(s *tokenState) {
+		s.token = token.Value
+		s.source = token.Source
+		s.tokenType = token.Type
+		s.scope = token.Scope
+		s.claims = token.Claims
+		s.expiry = expiry
+		s.stale = false
+		s.err = nil
+		s.generation++
+		s.parentGeneration = m.derivedFrom.Load()
+	})
+	m.requested.Store(0) // The new token may itself be behind the parent.
+	m.notifyChildren(m.load().generation, false)
+
+	m.statusMu.Lock()
+	m.status.Expiry = expiry
+	m.status.Stale = false
+	m.status.LastRefresh = now
+	m.statusMu.Unlock()
+}
+
+// expire clears the cached token. It must be called with the lock held.
+func (m *tokenRefresher) expire() {
+	m.update(func(s *tokenState) {
+		s.token = ""
+		s.stale = false
+	})
+	m.revoke()
+
+	m.statusMu.Lock()
+	m.status.Expiry = time.Time{}
+	m.status.Stale = false
+	m.statusMu.Unlock()
+}
+
+// markStale flags the cached token as stale, so it is only served until it
+// expires plus the stale grace period.
+func (m *tokenRefresher) markStale() {
+	m.mu.Lock()
+	m.update(func(s *tokenState) {
+		s.stale = true
+	})
+	m.mu.Unlock()
+
+	m.statusMu.Lock()
+	m.status.Stale = true
+	m.statusMu.Unlock()
+}
+
+// fail stores err so that GetToken returns it until the next successful
+// refresh, clearing the cached token unless stale tokens are served. It must
+// be called with the lock held.
+func (m *tokenRefresher) fail(err error) error {
+	if m.serveStale && m.load().token != "" {
+		m.update(func(s *tokenState) {
+			s.stale = true
+		})
+		m.statusMu.Lock()
+		m.status.Stale = true
+		m.statusMu.Unlock()
+	} else {
+		m.expire()
+	}
+	m.update(func(s *tokenState) {
+		s.err = err
+	})
+	m.onError(err, true)
+	m.logger.Crit("Permanent error refreshing token. Waiting for a manual refresh", "err", err)
+	return err
+}
+
+// setReason records why a refresh was started.
+func (m *tokenRefresher) setReason(reason string) {
+	m.statusMu.Lock()
+	m.status.Reason = reason
+	m.statusMu.Unlock()
+}
+
+// forced records and returns the reason passed to Refresh, after a forced
+// refresh request has been received.
+func (m *tokenRefresher) forced() string {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+
+	reason := m.forceReason
+	if reason == "" {
+		reason = "manual"
+	}
+	m.status.Reason = reason
+	return reason
+}
+
+// getRetriever returns the current retriever.
+func (m *tokenRefresher) getRetriever() TokenRetriever {
+	m.retrieverMu.Lock()
+	defer m.retrieverMu.Unlock()
+	return m.retriever
+}
+
+// isPermanent classifies err using the configured ErrorClassifier.
+func (m *tokenRefresher) isPermanent(err error) bool {
+	if m.classifier == nil {
+		return IsPermanent(err)
+	}
+	return m.classifier(err)
+}
+
+func (m *tokenRefresher) onRefresh(token string, expiresIn time.Duration) {
+	if m.hooks.OnRefresh != nil {
+		m.hooks.OnRefresh(token, expiresIn)
+	}
+}
+
+func (m *tokenRefresher) onError(err error, permanent bool) {
+	var p *PanicError
+	m.statusMu.Lock()
+	m.status.LastError = err
+	if errors.As(err, &p) {
+		m.status.Panics++
+	}
+	m.statusMu.Unlock()
+
+	if m.hooks.OnError != nil {
+		m.hooks.OnError(err, permanent)
+	}
+}
+
+// schedule resets timer to fire after d, draining it first if needed. If err
+// is non-nil the last refresh failed permanently, so the timer is left stopped
+// and only a call to Refresh will trigger another attempt.
+func schedule(timer *time.Timer, d time.Duration, err error) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	if err == nil {
+		timer.Reset(d)
+	}
+}
+
+// wait blocks for the Retry-After delay carried by err, if any. A call to
+// Refresh cuts the wait short, in which case wait reports true. It returns
+// ErrShutdown if done is closed first.
+func (m *tokenRefresher) wait(err error, done <-chan struct{}) (bool, error) {
+	d, ok := retryAfter(err)
+	if !ok {
+		return false, nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return false, nil
+	case <-m.force:
+		m.logger.Info("Forced refresh interrupting Retry-After delay", "reason", m.forced())
+		return true, nil
+	case <-done:
+		return false, ErrShutdown
+	}
+}
+
+// remainingBudget returns how much of b's max elapsed time is left. It
+// returns false for strategies without a max elapsed time.
+func remainingBudget(b backoff.BackOff) (time.Duration, bool) {
+	if j, ok := b.(*jitterBackOff); ok {
+		b = j.b
+	}
+	eb, ok := b.(*backoff.ExponentialBackOff)
+	if !ok || eb.MaxElapsedTime == 0 {
+		return 0, false
+	}
+	if remaining := eb.MaxElapsedTime - eb.GetElapsedTime(); remaining > 0 {
+		return remaining, true
+	}
+	return 0, true
+}
+
+// restartBackOff returns the strategy for delaying restarts of the refresher
+// goroutine after a panic.
+func (m *tokenRefresher) restartBackOff() backoff.BackOff {
+	if m.restarts == nil {
+		m.restarts = backoff.NewExponentialBackOff()
+		m.restarts.MaxElapsedTime = 0 // Never give up restarting.
+		m.restarts.Reset()
+	}
+	return m.restarts
 }
@@ -1,8 +1,11 @@
 package backoff
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -20,12 +23,16 @@ type mockRetriever struct {
 	incrementToken bool
 	token          string
 	expiresIn      time.Duration
+	err            error // Returned instead of mockRetrieverErr when set.
 }
 
 func (r *mockRetriever) RetrieveToken() (token string, expiresIn time.Duration, err error) {
 	r.called++
 	if r.numFails > 0 || r.permanentFail {
 		r.numFails--
+		if r.err != nil {
+			return "", 0, r.err
+		}
 		return "", 0, mockRetrieverErr
 	}
 
@@ -48,8 +55,8 @@ func TestGetToken(t *testing.T) {
 		logger: log15.New("global", "backoff_test"),
 		done:   make(chan struct{}),
 		force:  make(chan struct{}),
-		token:  wantToken,
 	}
+	m.setToken(Token{Value: wantToken}, time.Hour)
 
 	// Test the results.
 	gotToken, gotErr := m.GetToken()
@@ -74,8 +81,8 @@ func TestGetTokenError(t *testing.T) {
 		logger: log15.New("global", "backoff_test"),
 		done:   make(chan struct{}),
 		force:  make(chan struct{}),
-		token:  wantToken,
 	}
+	m.setToken(Token{Value: wantToken}, time.Hour)
 
 	// Test the results.
 	gotToken, gotErr := m.GetToken()
@@ -134,6 +141,207 @@ func TestCloseTwice(t *testing.T) {
 	}
 }
 
+func TestCloseContext(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantErr := error(nil)
+	wantCalled := 1
+
+	// Define tokenRefresher service.
+	retriever := mockRetriever{
+		token:     "cachedToken123",
+		expiresIn: 2 * time.Second,
+	}
+	m := NewTokenRefresher(log15.New("global", "backoff_test"), time.Second, &retriever)
+	time.Sleep(50 * time.Millisecond)
+
+	// Test the results.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	gotErr := m.CloseContext(ctx)
+	if gotErr != wantErr {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+	}
+
+	time.Sleep(1500 * time.Millisecond) // The token would have been refreshed by now.
+	if retriever.called != wantCalled {
+		t.Errorf("The retriever was called after CloseContext returned. Want '%v', Got '%v'", wantCalled, retriever.called)
+	}
+}
+
+func TestCloseContextCancelsRetrieval(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantErr := error(nil)
+
+	// Define tokenRefresher service.
+	retriever := slowRetriever{
+		token:     "cachedToken123",
+		delay:     time.Minute,
+		cancelled: make(chan struct{}),
+	}
+	m := NewTokenRefresher(log15.New("global", "backoff_test"), time.Second, &retriever)
+
+	// Test the results.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	gotErr := m.CloseContext(ctx)
+	if gotErr != wantErr {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+	}
+	select {
+	case <-retriever.cancelled:
+	default:
+		t.Errorf("The retrieval in flight was not cancelled")
+	}
+}
+
+func TestCloseContextDeadline(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantErr := context.DeadlineExceeded
+
+	// Define tokenRefresher service.
+	release := make(chan struct{})
+	retriever := RetrieverFunc(func(ctx context.Context) (Token, error) {
+		<-release // Ignores cancellation.
+		return Token{Value: "cachedToken123", Expiry: time.Now().Add(time.Hour)}, nil
+	})
+	m := NewTokenRefresher(log15.New("global", "backoff_test"), time.Second, blockingCall{retriever}, WithAttemptTimeout(10*time.Millisecond))
+	time.Sleep(50 * time.Millisecond) // Let the first attempt be abandoned.
+
+	// Test the results.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	gotErr := m.CloseContext(ctx)
+	if !errors.Is(gotErr, wantErr) {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+	}
+
+	close(release)
+	gotErr = m.CloseContext(context.Background())
+	if gotErr != nil {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+	}
+}
+
+// blockingCall hides that a retriever is context aware, so that it can't be
+// cancelled.
+type blockingCall struct {
+	r TokenRetriever
+}
+
+func (b blockingCall) RetrieveToken() (token string, expiresIn time.Duration, err error) {
+	return b.r.RetrieveToken()
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "cachedToken123"
+	wantErr := error(nil)
+
+	// Define tokenRefresher service.
+	retriever := mockRetriever{
+		token:     wantToken,
+		expiresIn: time.Hour,
+	}
+	m := NewRunnableTokenRefresher(log15.New("global", "backoff_test"), time.Minute, &retriever)
+
+	// Test the results.
+	time.Sleep(50 * time.Millisecond)
+	if retriever.called != 0 {
+		t.Errorf("The retriever was called before Run. Want '%v', Got '%v'", 0, retriever.called)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- m.Run(ctx)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	gotToken, gotErr := m.GetToken()
+	if gotErr != nil {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+	}
+	if gotToken != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken)
+	}
+	if gotErr := m.Run(ctx); gotErr != ErrRunning {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", ErrRunning, gotErr)
+	}
+
+	cancel()
+	select {
+	case gotErr := <-errs:
+		if gotErr != wantErr {
+			t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Run did not return after its context was cancelled")
+	}
+}
+
+func TestRunAfterClose(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantErr := ErrShutdown
+
+	// Define tokenRefresher service.
+	retriever := mockRetriever{
+		token:     "cachedToken123",
+		expiresIn: time.Hour,
+	}
+	m := NewRunnableTokenRefresher(log15.New("global", "backoff_test"), time.Minute, &retriever)
+
+	// Test the results.
+	m.Close()
+	gotErr := m.Run(context.Background())
+	if gotErr != wantErr {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+	}
+	if retriever.called != 0 {
+		t.Errorf("The retriever was called after Close. Want '%v', Got '%v'", 0, retriever.called)
+	}
+}
+
+func TestRunConcurrentCloseContext(t *testing.T) {
+	t.Parallel()
+
+	for i := 0; i < 50; i++ {
+		// Define tokenRefresher service.
+		var closed, calledAfterClose atomic.Bool
+		retriever := RetrieverFunc(func(ctx context.Context) (Token, error) {
+			if closed.Load() {
+				calledAfterClose.Store(true)
+			}
+			return Token{Value: "cachedToken123", Expiry: time.Now().Add(time.Hour)}, nil
+		})
+		m := NewRunnableTokenRefresher(log15.New("global", "backoff_test"), time.Minute, retriever)
+
+		// Test the results.
+		ran := make(chan struct{})
+		go func() {
+			defer close(ran)
+			m.Run(context.Background())
+		}()
+		if gotErr := m.CloseContext(context.Background()); gotErr != nil {
+			t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+		}
+		closed.Store(true)
+		<-ran
+		if calledAfterClose.Load() {
+			t.Fatalf("The retriever was called after CloseContext returned")
+		}
+	}
+}
+
 func TestRefreshInnerConstant(t *testing.T) {
 	t.Parallel()
 
@@ -161,8 +369,8 @@ func TestRefreshInnerConstant(t *testing.T) {
 	if gotErr != wantErr {
 		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
 	}
-	if gotToken != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken)
+	if gotToken.Value != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken.Value)
 	}
 	if gotExpiresIn != wantExpiresIn {
 		t.Errorf("An unexpected expiresIn was returned. Want '%v', Got '%v'", wantExpiresIn, gotExpiresIn)
@@ -201,8 +409,8 @@ func TestRefreshInnerExponential(t *testing.T) {
 	if gotErr != wantErr {
 		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
 	}
-	if gotToken != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken)
+	if gotToken.Value != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken.Value)
 	}
 	if gotExpiresIn != wantExpiresIn {
 		t.Errorf("An unexpected expiresIn was returned. Want '%v', Got '%v'", wantExpiresIn, gotExpiresIn)
@@ -240,8 +448,8 @@ func TestRefreshInnerExponentialMaxElapsed(t *testing.T) {
 	if gotErr != wantErr {
 		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
 	}
-	if gotToken != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken)
+	if gotToken.Value != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken.Value)
 	}
 	if gotExpiresIn != wantExpiresIn {
 		t.Errorf("An unexpected expiresIn was returned. Want '%v', Got '%v'", wantExpiresIn, gotExpiresIn)
@@ -278,8 +486,8 @@ func TestRefreshInnerCancellation(t *testing.T) {
 	if gotErr != wantErr {
 		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
 	}
-	if gotToken != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken)
+	if gotToken.Value != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken.Value)
 	}
 	if gotExpiresIn != wantExpiresIn {
 		t.Errorf("An unexpected expiresIn was returned. Want '%v', Got '%v'", wantExpiresIn, gotExpiresIn)
@@ -316,8 +524,8 @@ func TestRefreshInternalForceImmediateSuccess(t *testing.T) {
 	if gotErr != wantErr {
 		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
 	}
-	if m.token != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.token)
+	if m.load().token != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.load().token)
 	}
 	if gotExpiresIn != wantExpiresIn {
 		t.Errorf("An unexpected expiresIn was returned. Want '%v', Got '%v'", wantExpiresIn, gotExpiresIn)
@@ -328,7 +536,7 @@ func TestRefreshInternalForceImmediateSuccess(t *testing.T) {
 
 	gotToken, _ := m.GetToken() // Confirms the lock is unlocked.
 	if gotToken != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.token)
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.load().token)
 	}
 }
 
@@ -362,8 +570,8 @@ func TestRefreshInternalForceExponentialSuccess(t *testing.T) {
 	if gotErr != wantErr {
 		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
 	}
-	if m.token != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.token)
+	if m.load().token != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.load().token)
 	}
 	if gotExpiresIn != wantExpiresIn {
 		t.Errorf("An unexpected expiresIn was returned. Want '%v', Got '%v'", wantExpiresIn, gotExpiresIn)
@@ -374,7 +582,7 @@ func TestRefreshInternalForceExponentialSuccess(t *testing.T) {
 
 	gotToken, _ := m.GetToken() // Confirms the lock is unlocked.
 	if gotToken != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.token)
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.load().token)
 	}
 }
 
@@ -412,8 +620,8 @@ func TestRefreshInternalForceExponentialShutdown(t *testing.T) {
 	if gotErr != wantErr {
 		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
 	}
-	if m.token != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.token)
+	if m.load().token != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.load().token)
 	}
 	if gotExpiresIn != wantExpiresIn {
 		t.Errorf("An unexpected expiresIn was returned. Want '%v', Got '%v'", wantExpiresIn, gotExpiresIn)
@@ -421,7 +629,7 @@ func TestRefreshInternalForceExponentialShutdown(t *testing.T) {
 
 	gotToken, gotGetTokenErr := m.GetToken() // Confirms the lock is unlocked.
 	if gotToken != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.token)
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.load().token)
 	}
 	if gotGetTokenErr.Error() != wantGetTokenErr.Error() {
 		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantGetTokenErr, gotGetTokenErr)
@@ -458,8 +666,8 @@ func TestRefreshInternalForceConstantSuccess(t *testing.T) {
 	if gotErr != wantErr {
 		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
 	}
-	if m.token != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.token)
+	if m.load().token != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.load().token)
 	}
 	if gotExpiresIn != wantExpiresIn {
 		t.Errorf("An unexpected expiresIn was returned. Want '%v', Got '%v'", wantExpiresIn, gotExpiresIn)
@@ -470,7 +678,7 @@ func TestRefreshInternalForceConstantSuccess(t *testing.T) {
 
 	gotToken, _ := m.GetToken() // Confirms the lock is unlocked.
 	if gotToken != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.token)
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.load().token)
 	}
 }
 
@@ -509,8 +717,8 @@ func TestRefreshInternalConstantShutdown(t *testing.T) {
 	if gotErr != wantErr {
 		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
 	}
-	if m.token != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.token)
+	if m.load().token != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.load().token)
 	}
 	if gotExpiresIn != wantExpiresIn {
 		t.Errorf("An unexpected expiresIn was returned. Want '%v', Got '%v'", wantExpiresIn, gotExpiresIn)
@@ -521,7 +729,7 @@ func TestRefreshInternalConstantShutdown(t *testing.T) {
 
 	gotToken, gotGetTokenErr := m.GetToken() // Confirms the lock is unlocked.
 	if gotToken != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.token)
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.load().token)
 	}
 	if gotGetTokenErr.Error() != wantGetTokenErr.Error() {
 		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantGetTokenErr, gotGetTokenErr)
@@ -558,8 +766,8 @@ func TestRefreshInternalExponentialSuccess(t *testing.T) {
 	if gotErr != wantErr {
 		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
 	}
-	if m.token != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.token)
+	if m.load().token != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.load().token)
 	}
 	if gotExpiresIn != wantExpiresIn {
 		t.Errorf("An unexpected expiresIn was returned. Want '%v', Got '%v'", wantExpiresIn, gotExpiresIn)
@@ -570,7 +778,7 @@ func TestRefreshInternalExponentialSuccess(t *testing.T) {
 
 	gotToken, _ := m.GetToken() // Confirms the lock is unlocked.
 	if gotToken != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.token)
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.load().token)
 	}
 }
 
@@ -608,8 +816,8 @@ func TestRefreshInternalExponentialShutdown(t *testing.T) {
 	if gotErr != wantErr {
 		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
 	}
-	if m.token != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.token)
+	if m.load().token != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.load().token)
 	}
 	if gotExpiresIn != wantExpiresIn {
 		t.Errorf("An unexpected expiresIn was returned. Want '%v', Got '%v'", wantExpiresIn, gotExpiresIn)
@@ -617,7 +825,7 @@ func TestRefreshInternalExponentialShutdown(t *testing.T) {
 
 	gotToken, gotGetTokenErr := m.GetToken() // Confirms the lock is unlocked.
 	if gotToken != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.token)
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.load().token)
 	}
 	if gotGetTokenErr.Error() != wantGetTokenErr.Error() {
 		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantGetTokenErr, gotGetTokenErr)
@@ -654,8 +862,8 @@ func TestRefreshInternalConstantSuccess(t *testing.T) {
 	if gotErr != wantErr {
 		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
 	}
-	if m.token != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.token)
+	if m.load().token != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.load().token)
 	}
 	if gotExpiresIn != wantExpiresIn {
 		t.Errorf("An unexpected expiresIn was returned. Want '%v', Got '%v'", wantExpiresIn, gotExpiresIn)
@@ -666,7 +874,7 @@ func TestRefreshInternalConstantSuccess(t *testing.T) {
 
 	gotToken, _ := m.GetToken() // Confirms the lock is unlocked.
 	if gotToken != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.token)
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.load().token)
 	}
 }
 
@@ -698,20 +906,20 @@ func TestGetTokenLockedDuringForce(t *testing.T) {
 	// Test the results.
 	go func() {
 		time.Sleep(time.Millisecond * 200)
-		if m.token != wantTokenInitial {
-			t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenInitial, m.token)
+		if m.load().token != wantTokenInitial {
+			t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenInitial, m.load().token)
 		}
 		gotToken, _ := m.GetToken() // This should only return once the lock is released and the token has been updated.
 		if gotToken != wantTokenFinal {
-			t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenFinal, m.token)
+			t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenFinal, m.load().token)
 		}
 	}()
 	gotExpiresIn, gotErr := m.refresh(true)
 	if gotErr != wantErr {
 		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
 	}
-	if m.token != wantTokenFinal {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenFinal, m.token)
+	if m.load().token != wantTokenFinal {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenFinal, m.load().token)
 	}
 	if gotExpiresIn != wantExpiresIn {
 		t.Errorf("An unexpected expiresIn was returned. Want '%v', Got '%v'", wantExpiresIn, gotExpiresIn)
@@ -719,7 +927,7 @@ func TestGetTokenLockedDuringForce(t *testing.T) {
 
 	gotToken, _ := m.GetToken() // Confirms the lock is unlocked.
 	if gotToken != wantTokenFinal {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenFinal, m.token)
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenFinal, m.load().token)
 	}
 }
 
@@ -746,26 +954,26 @@ func TestGetTokenNotLockedDuringTimed(t *testing.T) {
 		force:         make(chan struct{}),
 		refreshBuffer: refreshBuffer,
 		retriever:     &retriever,
-		token:         wantTokenInitial,
 	}
+	m.setToken(Token{Value: wantTokenInitial}, time.Hour)
 
 	// Test the results.
 	go func() {
 		time.Sleep(time.Millisecond * 200)
-		if m.token != wantTokenInitial {
-			t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenInitial, m.token)
+		if m.load().token != wantTokenInitial {
+			t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenInitial, m.load().token)
 		}
 		gotToken, _ := m.GetToken() // This should return immediately because the previous token hasn't expired yet (timed refresh, during exponential phase).
 		if gotToken != wantTokenInitial {
-			t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenInitial, m.token)
+			t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenInitial, m.load().token)
 		}
 	}()
 	gotExpiresIn, gotErr := m.refresh(false)
 	if gotErr != wantErr {
 		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
 	}
-	if m.token != wantTokenFinal {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenFinal, m.token)
+	if m.load().token != wantTokenFinal {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenFinal, m.load().token)
 	}
 	if gotExpiresIn != wantExpiresIn {
 		t.Errorf("An unexpected expiresIn was returned. Want '%v', Got '%v'", wantExpiresIn, gotExpiresIn)
@@ -773,7 +981,7 @@ func TestGetTokenNotLockedDuringTimed(t *testing.T) {
 
 	gotToken, _ := m.GetToken() // Confirms the lock is unlocked.
 	if gotToken != wantTokenFinal {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenFinal, m.token)
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenFinal, m.load().token)
 	}
 }
 
@@ -804,17 +1012,17 @@ func TestTokenRefresherTimed(t *testing.T) {
 	}
 
 	// Test the results.
-	if m.token != wantTokenInitial {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenInitial, m.token)
+	if m.load().token != wantTokenInitial {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenInitial, m.load().token)
 	}
 	go m.refresher()
 	time.Sleep(100 * time.Millisecond)
-	if m.token != wantTokenStartup {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenStartup, m.token)
+	if m.load().token != wantTokenStartup {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenStartup, m.load().token)
 	}
 	time.Sleep(1 * time.Second)
-	if m.token != wantTokenRefresh {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenRefresh, m.token)
+	if m.load().token != wantTokenRefresh {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenRefresh, m.load().token)
 	}
 	if retriever.called != wantCalled {
 		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalled, retriever.called)
@@ -849,18 +1057,21 @@ func TestTokenRefresherForce(t *testing.T) {
 	}
 
 	// Test the results.
-	if m.token != wantTokenInitial {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenInitial, m.token)
+	if m.load().token != wantTokenInitial {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenInitial, m.load().token)
 	}
 	go m.refresher()
 	time.Sleep(100 * time.Millisecond)
-	if m.token != wantTokenStartup {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenStartup, m.token)
+	if m.load().token != wantTokenStartup {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenStartup, m.load().token)
 	}
-	m.Refresh()
+	m.Refresh("test")
 	time.Sleep(100 * time.Millisecond)
-	if m.token != wantTokenRefresh {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenRefresh, m.token)
+	if m.load().token != wantTokenRefresh {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenRefresh, m.load().token)
+	}
+	if gotReason := m.Status().Reason; gotReason != "test" {
+		t.Errorf("An unexpected refresh reason was recorded. Want '%v', Got '%v'", "test", gotReason)
 	}
 	if retriever.called != wantCalled {
 		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalled, retriever.called)
@@ -892,14 +1103,14 @@ func TestTokenRefresherShutdown(t *testing.T) {
 	}
 
 	// Test the results.
-	if m.token != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.token)
+	if m.load().token != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.load().token)
 	}
 	go m.refresher()
 	m.Close()
 	time.Sleep(100 * time.Millisecond)
-	if m.token != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.token)
+	if m.load().token != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.load().token)
 	}
 }
 
@@ -927,13 +1138,645 @@ func TestTokenRefresherRecovery(t *testing.T) {
 	// Test the results.
 	go m.refresher()
 	time.Sleep(1 * time.Millisecond)
+	m.retrieverMu.Lock() // Unlike SetRetriever, doesn't request a refresh.
 	m.retriever = &retriever
-	time.Sleep(100 * time.Millisecond)
-	if m.token != wantToken {
-		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.token)
+	m.retrieverMu.Unlock()
+	time.Sleep(time.Second) // The nil retriever's panics are failed attempts, so wait for the next exponential tick.
+	if m.load().token != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.load().token)
+	}
+	if retriever.called != wantCalled {
+		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalled, retriever.called)
+	}
+	if gotStatus := m.Status(); gotStatus.Panics == 0 || gotStatus.Restarts != 0 {
+		t.Errorf("An unexpected status was returned. Want panics without restarts, Got '%+v'", gotStatus)
+	}
+	m.Close()
+}
+
+func TestTokenRefresherRestartAfterPanic(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "newToken123"
+	wantCalled := 2
+	wantRestarts := 1
+
+	// Define tokenRefresher service.
+	retriever := mockRetriever{
+		token:     wantToken,
+		expiresIn: time.Second * 3600,
+	}
+	var panicked bool
+	m := tokenRefresher{
+		logger:        log15.New("global", "backoff_test"),
+		done:          make(chan struct{}),
+		force:         make(chan struct{}),
+		refreshBuffer: 5 * time.Minute,
+		retriever:     &retriever,
+		hooks: Hooks{
+			OnRefresh: func(token string, expiresIn time.Duration) {
+				if !panicked {
+					panicked = true
+					panic("hook panic")
+				}
+			},
+		},
+	}
+
+	// Test the results.
+	go m.refresher()
+	time.Sleep(1500 * time.Millisecond) // Longer than the first restart delay.
+	gotToken, _ := m.GetToken()         // Confirms the lock was released by the panic.
+	if gotToken != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken)
+	}
+	if retriever.called != wantCalled {
+		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalled, retriever.called)
+	}
+	if gotStatus := m.Status(); gotStatus.Restarts != wantRestarts {
+		t.Errorf("An unexpected number of restarts occurred. Want '%v', Got '%v'", wantRestarts, gotStatus.Restarts)
+	}
+	m.Close()
+}
+
+func TestRefreshInnerPermanent(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := ""
+	wantErr := Permanent(errors.New("invalid_client"))
+	wantCalled := 1
+
+	// Define tokenRefresher service.
+	retriever := mockRetriever{
+		permanentFail: true,
+		err:           wantErr,
+	}
+	m := tokenRefresher{
+		logger:    log15.New("global", "backoff_test"),
+		done:      make(chan struct{}),
+		force:     make(chan struct{}),
+		retriever: &retriever,
+	}
+
+	// Test the results.
+	gotToken, _, gotErr := m.refreshInner(backoff.NewConstantBackOff(1*time.Microsecond), m.done)
+	if gotErr != wantErr {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+	}
+	if gotToken.Value != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken.Value)
+	}
+	if retriever.called != wantCalled {
+		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalled, retriever.called)
+	}
+}
+
+func TestRefreshInternalPermanent(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantErr := Permanent(errors.New("invalid_client"))
+	wantCalled := 1
+	wantHookCalls := 1
+
+	// Define tokenRefresher service.
+	retriever := mockRetriever{
+		permanentFail: true,
+		err:           wantErr,
+	}
+	var hookCalls int
+	m := tokenRefresher{
+		logger:        log15.New("global", "backoff_test"),
+		done:          make(chan struct{}),
+		force:         make(chan struct{}),
+		refreshBuffer: 5 * time.Minute,
+		retriever:     &retriever,
+		hooks: Hooks{
+			OnError: func(err error, permanent bool) {
+				if permanent {
+					hookCalls++
+				}
+			},
+		},
+	}
+	m.setToken(Token{Value: "cachedToken123"}, time.Hour)
+
+	// Test the results.
+	for _, force := range []bool{true, false} {
+		retriever.called = 0
+		_, gotErr := m.refresh(force)
+		if gotErr != wantErr {
+			t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+		}
+		if retriever.called != wantCalled {
+			t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalled, retriever.called)
+		}
+
+		gotToken, gotGetTokenErr := m.GetToken() // Confirms the lock is unlocked.
+		if gotToken != "" {
+			t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", "", gotToken)
+		}
+		if gotGetTokenErr != wantErr {
+			t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotGetTokenErr)
+		}
+	}
+	if hookCalls != 2*wantHookCalls {
+		t.Errorf("The OnError hook was called an unexpected number of times. Want '%v', Got '%v'", 2*wantHookCalls, hookCalls)
+	}
+}
+
+func TestRefreshInternalErrorClassifier(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantErr := errors.New("invalid_client")
+	wantCalled := 1
+
+	// Define tokenRefresher service.
+	retriever := mockRetriever{
+		permanentFail: true,
+		err:           wantErr,
+	}
+	m := tokenRefresher{
+		logger:        log15.New("global", "backoff_test"),
+		done:          make(chan struct{}),
+		force:         make(chan struct{}),
+		refreshBuffer: 5 * time.Minute,
+		retriever:     &retriever,
+	}
+	WithErrorClassifier(func(err error) bool { return err == wantErr })(&m)
+
+	// Test the results.
+	_, gotErr := m.refresh(true)
+	if gotErr != wantErr {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
 	}
 	if retriever.called != wantCalled {
 		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalled, retriever.called)
 	}
+}
+
+func TestTokenRefresherPermanentWaitsForRefresh(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	expiresIn := 2 * time.Second
+	refreshBuffer := time.Second
+	wantToken := "newToken"
+	wantErr := Permanent(errors.New("invalid_client"))
+	wantCalledBefore := 1
+	wantCalledAfter := 2
+
+	// Define tokenRefresher service.
+	retriever := mockRetriever{
+		numFails:  1,
+		err:       wantErr,
+		token:     wantToken,
+		expiresIn: expiresIn,
+	}
+	m := tokenRefresher{
+		logger:        log15.New("global", "backoff_test"),
+		done:          make(chan struct{}),
+		force:         make(chan struct{}),
+		refreshBuffer: refreshBuffer,
+		retriever:     &retriever,
+	}
+
+	// Test the results.
+	go m.refresher()
+	time.Sleep(1200 * time.Millisecond) // Longer than the timed refresh would have waited.
+	if _, gotErr := m.GetToken(); gotErr != wantErr {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+	}
+	if retriever.called != wantCalledBefore {
+		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalledBefore, retriever.called)
+	}
+	m.SetRetriever(&retriever)
+	time.Sleep(100 * time.Millisecond)
+	if gotToken, _ := m.GetToken(); gotToken != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken)
+	}
+	if retriever.called != wantCalledAfter {
+		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalledAfter, retriever.called)
+	}
 	m.Close()
 }
+
+func TestRefreshInnerRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "newToken123"
+	wantErr := error(nil)
+	wantCalled := 2
+	wantDelay := 200 * time.Millisecond
+
+	// Define tokenRefresher service.
+	retriever := mockRetriever{
+		numFails:  1,
+		err:       RetryAfter(mockRetrieverErr, wantDelay),
+		token:     wantToken,
+		expiresIn: time.Second * 3600,
+	}
+	m := tokenRefresher{
+		logger:    log15.New("global", "backoff_test"),
+		done:      make(chan struct{}),
+		force:     make(chan struct{}),
+		retriever: &retriever,
+	}
+
+	// Test the results.
+	start := time.Now()
+	gotToken, _, gotErr := m.refreshInner(backoff.NewConstantBackOff(1*time.Microsecond), m.done)
+	gotDelay := time.Since(start)
+	if gotErr != wantErr {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+	}
+	if gotToken.Value != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken.Value)
+	}
+	if gotDelay < wantDelay {
+		t.Errorf("The Retry-After hint was not honored. Want at least '%v', Got '%v'", wantDelay, gotDelay)
+	}
+	if retriever.called != wantCalled {
+		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalled, retriever.called)
+	}
+}
+
+func TestRefreshInnerRetryAfterForced(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "newToken123"
+	wantCalled := 2
+	maxDelay := time.Second
+
+	// Define tokenRefresher service.
+	retriever := mockRetriever{
+		numFails:  1,
+		err:       RetryAfter(mockRetrieverErr, 5*time.Second),
+		token:     wantToken,
+		expiresIn: time.Second * 3600,
+	}
+	m := tokenRefresher{
+		logger:    log15.New("global", "backoff_test"),
+		done:      make(chan struct{}),
+		force:     make(chan struct{}),
+		retriever: &retriever,
+	}
+
+	// Test the results.
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		m.Refresh("test")
+	}()
+	start := time.Now()
+	gotToken, _, gotErr := m.refreshInner(backoff.NewConstantBackOff(1*time.Microsecond), m.done)
+	if gotErr != nil {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+	}
+	if gotToken.Value != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken.Value)
+	}
+	if gotDelay := time.Since(start); gotDelay > maxDelay {
+		t.Errorf("Refresh did not interrupt the Retry-After delay. Want less than '%v', Got '%v'", maxDelay, gotDelay)
+	}
+	if retriever.called != wantCalled {
+		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalled, retriever.called)
+	}
+	if gotReason := m.Status().Reason; gotReason != "test" {
+		t.Errorf("An unexpected reason was recorded. Want '%v', Got '%v'", "test", gotReason)
+	}
+}
+
+func TestRefreshInnerRetryAfterExceedsBudget(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantErr := mockRetrieverErr
+	wantRetryAfter := 4 * time.Second // The part of the hint past the max elapsed time.
+	wantCalled := 1
+	maxElapsed := time.Second
+
+	// Define tokenRefresher service.
+	retriever := mockRetriever{
+		permanentFail: true,
+		err:           RetryAfter(mockRetrieverErr, 5*time.Second),
+	}
+	m := tokenRefresher{
+		logger:    log15.New("global", "backoff_test"),
+		done:      make(chan struct{}),
+		force:     make(chan struct{}),
+		retriever: &retriever,
+	}
+
+	// Test the results.
+	eb := backoff.NewExponentialBackOff()
+	eb.MaxElapsedTime = maxElapsed
+	start := time.Now()
+	_, _, gotErr := m.refreshInner(eb, m.done)
+	gotDelay := time.Since(start)
+	if !errors.Is(gotErr, wantErr) {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+	}
+	if gotRetryAfter, _ := retryAfter(gotErr); gotRetryAfter < wantRetryAfter || gotRetryAfter > wantRetryAfter+100*time.Millisecond {
+		t.Errorf("An unexpected Retry-After delay was returned. Want '%v', Got '%v'", wantRetryAfter, gotRetryAfter)
+	}
+	if gotDelay < maxElapsed-100*time.Millisecond || gotDelay > maxElapsed+100*time.Millisecond {
+		t.Errorf("The exponential phase did not end on schedule. Want '%v', Got '%v'", maxElapsed, gotDelay)
+	}
+	if retriever.called != wantCalled {
+		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalled, retriever.called)
+	}
+}
+
+func TestRefreshRetryAfterExceedsBuffer(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantTokenInitial := "cachedToken123"
+	wantTokenFinal := "newToken123"
+	wantCalled := 2
+
+	// Define tokenRefresher service.
+	retriever := mockRetriever{
+		numFails:  1,
+		err:       RetryAfter(mockRetrieverErr, 1500*time.Millisecond), // Longer than the 1s exponential phase.
+		token:     wantTokenFinal,
+		expiresIn: time.Hour,
+	}
+	m := tokenRefresher{
+		logger:        log15.New("global", "backoff_test"),
+		done:          make(chan struct{}),
+		force:         make(chan struct{}),
+		refreshBuffer: 2 * time.Second,
+		retriever:     &retriever,
+	}
+	m.setToken(Token{Value: wantTokenInitial}, 10*time.Second)
+
+	// Test the results.
+	checked := make(chan struct{})
+	go func() {
+		defer close(checked)
+		time.Sleep(200 * time.Millisecond)
+		got := make(chan string, 1)
+		go func() {
+			gotToken, _ := m.GetToken() // This should return immediately with the still valid token.
+			got <- gotToken
+		}()
+		select {
+		case gotToken := <-got:
+			if gotToken != wantTokenInitial {
+				t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenInitial, gotToken)
+			}
+		case <-time.After(100 * time.Millisecond):
+			t.Errorf("GetToken blocked while the token was still valid")
+		}
+	}()
+	_, gotErr := m.refresh(false)
+	<-checked
+	if gotErr != nil {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+	}
+	if retriever.called != wantCalled {
+		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalled, retriever.called)
+	}
+	if gotToken, _ := m.GetToken(); gotToken != wantTokenFinal {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantTokenFinal, gotToken)
+	}
+}
+
+func TestRefreshInternalServeStale(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	expiresIn := time.Second * 3600
+	refreshBuffer := time.Millisecond // Will give us a negative max elapsed time, causing the exponential backoff to stop after the first (guaranteed) tick.
+	wantTokenInitial := "cachedToken123"
+	wantTokenFinal := "newToken123"
+	wantErr := error(nil)
+	wantCalled := 2
+
+	// Define tokenRefresher service.
+	retriever := mockRetriever{
+		numFails:  1,
+		err:       RetryAfter(mockRetrieverErr, 200*time.Millisecond), // Holds off the constant phase while the token is stale.
+		token:     wantTokenFinal,
+		expiresIn: expiresIn,
+	}
+	m := tokenRefresher{
+		logger:        log15.New("global", "backoff_test"),
+		done:          make(chan struct{}),
+		force:         make(chan struct{}),
+		refreshBuffer: refreshBuffer,
+		retriever:     &retriever,
+	}
+	WithServeStale(0)(&m)
+	m.setToken(Token{Value: wantTokenInitial}, time.Minute)
+
+	// Test the results.
+	checked := make(chan struct{})
+	go func() {
+		defer close(checked)
+		time.Sleep(100 * time.Millisecond)
+		gotToken, gotErr := m.Token() // This should return immediately with the stale token.
+		if gotErr != nil {
+			t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+		}
+		if gotToken.Value != wantTokenInitial || !gotToken.Stale {
+			t.Errorf("An unexpected token was returned. Want stale '%v', Got '%+v'", wantTokenInitial, gotToken)
+		}
+		if gotStatus := m.Status(); !gotStatus.Stale || gotStatus.LastError == nil {
+			t.Errorf("An unexpected status was returned. Want stale with an error, Got '%+v'", gotStatus)
+		}
+	}()
+	_, gotErr := m.refresh(false)
+	<-checked
+	if gotErr != wantErr {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+	}
+	if retriever.called != wantCalled {
+		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalled, retriever.called)
+	}
+
+	gotToken, _ := m.Token()
+	if gotToken.Value != wantTokenFinal || gotToken.Stale {
+		t.Errorf("An unexpected token was returned. Want fresh '%v', Got '%+v'", wantTokenFinal, gotToken)
+	}
+	if gotStatus := m.Status(); gotStatus.Stale || gotStatus.Expiry.Before(time.Now().Add(expiresIn-time.Minute)) {
+		t.Errorf("An unexpected status was returned. Want fresh expiring in '%v', Got '%+v'", expiresIn, gotStatus)
+	}
+}
+
+func TestTokenStaleGrace(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "cachedToken123"
+	wantErr := errors.New("Token is invalid or expired")
+
+	// Define tokenRefresher service.
+	m := tokenRefresher{
+		logger: log15.New("global", "backoff_test"),
+		done:   make(chan struct{}),
+		force:  make(chan struct{}),
+	}
+	m.setToken(Token{Value: wantToken}, -2*time.Second) // Expired two seconds ago.
+	m.markStale()
+
+	// Test the results.
+	WithServeStale(5 * time.Second)(&m)
+	if gotToken, gotErr := m.GetToken(); gotToken != wantToken || gotErr != nil {
+		t.Errorf("The stale token was not served within the grace period. Want '%v', Got '%v' '%v'", wantToken, gotToken, gotErr)
+	}
+
+	WithServeStale(time.Second)(&m)
+	if gotToken, gotErr := m.GetToken(); gotToken != "" || gotErr == nil || gotErr.Error() != wantErr.Error() {
+		t.Errorf("The stale token was served after the grace period. Want '%v', Got '%v' '%v'", wantErr, gotToken, gotErr)
+	}
+}
+
+// hangingRetriever hangs on its first numHangs calls, ignoring cancellation,
+// then returns token.
+type hangingRetriever struct {
+	mu       sync.Mutex
+	called   int
+	numHangs int
+	token    string
+}
+
+func (r *hangingRetriever) RetrieveToken() (token string, expiresIn time.Duration, err error) {
+	r.mu.Lock()
+	r.called++
+	hang := r.called <= r.numHangs
+	r.mu.Unlock()
+
+	if hang {
+		select {} // Abandoned by the attempt timeout.
+	}
+	return r.token, time.Hour, nil
+}
+
+func TestRefreshInternalAttemptTimeout(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "newToken123"
+	wantErr := error(nil)
+	wantCalled := 2
+	maxDelay := 2 * time.Second
+
+	// Define tokenRefresher service.
+	retriever := hangingRetriever{
+		numHangs: 1,
+		token:    wantToken,
+	}
+	m := tokenRefresher{
+		logger:        log15.New("global", "backoff_test"),
+		done:          make(chan struct{}),
+		force:         make(chan struct{}),
+		refreshBuffer: 5 * time.Minute,
+		retriever:     &retriever,
+	}
+	WithAttemptTimeout(50 * time.Millisecond)(&m)
+
+	// Test the results.
+	start := time.Now()
+	_, gotErr := m.refresh(true)
+	if gotErr != wantErr {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+	}
+	if gotDelay := time.Since(start); gotDelay > maxDelay {
+		t.Errorf("The hung attempt was not abandoned in time. Want less than '%v', Got '%v'", maxDelay, gotDelay)
+	}
+	if gotToken, _ := m.GetToken(); gotToken != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken)
+	}
+	if retriever.called != wantCalled {
+		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalled, retriever.called)
+	}
+	if gotStatus := m.Status(); !errors.Is(gotStatus.LastError, context.DeadlineExceeded) {
+		t.Errorf("The timed out attempt was not recorded. Want '%v', Got '%v'", context.DeadlineExceeded, gotStatus.LastError)
+	}
+}
+
+func TestRefreshInnerAttemptTimeoutCancels(t *testing.T) {
+	t.Parallel()
+
+	// Define tokenRefresher service.
+	retriever := slowRetriever{
+		token:     "NeverReturnedToken",
+		delay:     time.Minute,
+		cancelled: make(chan struct{}),
+	}
+	m := tokenRefresher{
+		logger:    log15.New("global", "backoff_test"),
+		done:      make(chan struct{}),
+		force:     make(chan struct{}),
+		retriever: &retriever,
+	}
+	WithAttemptTimeout(50 * time.Millisecond)(&m)
+
+	// Test the results.
+	eb := backoff.NewExponentialBackOff()
+	eb.MaxElapsedTime = 10 * time.Millisecond // Stop after the first attempt.
+	_, _, gotErr := m.refreshInner(eb, m.done)
+	if !errors.Is(gotErr, context.DeadlineExceeded) {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", context.DeadlineExceeded, gotErr)
+	}
+	select {
+	case <-retriever.cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("The timed out attempt was not cancelled")
+	}
+}
+
+func TestRefreshInternalForcePreemptsBackoff(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "newToken123"
+	wantErr := error(nil)
+	wantCalled := 2
+	wantReason := "token rejected"
+	maxDelay := 200 * time.Millisecond // The next exponential tick is at least 250ms away.
+
+	// Define tokenRefresher service.
+	retriever := mockRetriever{
+		numFails:  1,
+		token:     wantToken,
+		expiresIn: time.Second * 3600,
+	}
+	m := tokenRefresher{
+		logger:        log15.New("global", "backoff_test"),
+		done:          make(chan struct{}),
+		force:         make(chan struct{}),
+		refreshBuffer: 5 * time.Minute,
+		retriever:     &retriever,
+	}
+
+	// Test the results.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		m.Refresh(wantReason)
+	}()
+	start := time.Now()
+	_, gotErr := m.refresh(false)
+	if gotErr != wantErr {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+	}
+	if gotDelay := time.Since(start); gotDelay > maxDelay {
+		t.Errorf("The forced refresh did not preempt the backoff. Want less than '%v', Got '%v'", maxDelay, gotDelay)
+	}
+	if m.load().token != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, m.load().token)
+	}
+	if retriever.called != wantCalled {
+		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalled, retriever.called)
+	}
+	if gotReason := m.Status().Reason; gotReason != wantReason {
+		t.Errorf("An unexpected refresh reason was recorded. Want '%v', Got '%v'", wantReason, gotReason)
+	}
+}
@@ -0,0 +1,124 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// ChainLink is a TokenRetriever in a ChainRetriever, along with the name
+// reported as the Source of the tokens it produces.
+type ChainLink struct {
+	Name      string
+	Retriever TokenRetriever
+}
+
+// ChainRetriever retrieves tokens from the first healthy TokenRetriever in a
+// priority ordered list, e.g. a primary token service, a secondary region and
+// a break-glass static credential.
+//
+// When the healthy retriever fails, ChainRetriever fails over to the others in
+// priority order and remembers the first one that succeeds. While failed over,
+// it probes the higher priority retrievers at most once per probe interval,
+// failing back as soon as one of them succeeds.
+type ChainRetriever struct {
+	logger        log15.Logger
+	links         []ChainLink
+	probeInterval time.Duration
+
+	mu        sync.Mutex
+	healthy   int
+	lastProbe time.Time
+}
+
+// NewChainRetriever creates a ChainRetriever trying links in the given order.
+func NewChainRetriever(logger log15.Logger, probeInterval time.Duration, links ...ChainLink) *ChainRetriever {
+	return &ChainRetriever{
+		logger:        logger,
+		links:         links,
+		probeInterval: probeInterval,
+	}
+}
+
+// RetrieveToken implements TokenRetriever.
+func (c *ChainRetriever) RetrieveToken() (token string, expiresIn time.Duration, err error) {
+	t, expiresIn, err := retrieveContext(context.Background(), c)
+	return t.Value, expiresIn, err
+}
+
+// RetrieveTokenContext implements ContextRetriever. The returned token's
+// Source is the name of the link that produced it.
+//
+// If every link fails, the error is permanent only if every link failed
+// permanently.
+func (c *ChainRetriever) RetrieveTokenContext(ctx context.Context) (Token, error) {
+	var errs []error
+	for _, i := range c.order() {
+		link := c.links[i]
+		token, _, err := retrieveContext(ctx, link.Retriever)
+		if err == nil {
+			c.setHealthy(i)
+			if token.Source == "" {
+				token.Source = link.Name
+			}
+			return token, nil
+		}
+
+		c.logger.Warn("Token retriever failed", "source", link.Name, "err", err)
+		errs = append(errs, fmt.Errorf("%s: %w", link.Name, err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if len(errs) == 0 {
+		return Token{}, Permanent(errors.New("no token retrievers configured"))
+	}
+	return Token{}, combineErrors("all token retrievers failed", errs)
+}
+
+// order returns the indexes of the links to try: all of them in priority
+// order if a probe is due, otherwise the healthy link first, then the rest in
+// priority order.
+func (c *ChainRetriever) order() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.links) == 0 {
+		return nil
+	}
+	start := c.healthy
+	if start > 0 && time.Since(c.lastProbe) >= c.probeInterval {
+		c.lastProbe = time.Now()
+		start = 0
+	}
+	order := make([]int, 0, len(c.links))
+	order = append(order, start)
+	for i := range c.links {
+		if i != start {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// setHealthy records the link that last produced a token.
+func (c *ChainRetriever) setHealthy(i int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if i == c.healthy {
+		return
+	}
+	if i < c.healthy {
+		c.logger.Info("Failing back to token retriever", "source", c.links[i].Name)
+	} else {
+		c.logger.Warn("Failing over to token retriever", "source", c.links[i].Name)
+		c.lastProbe = time.Now()
+	}
+	c.healthy = i
+}
@@ -0,0 +1,157 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+func TestChainRetrieverFailover(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "secondaryToken"
+	wantSource := "secondary"
+	wantPrimaryCalled := 1
+	wantSecondaryCalled := 2
+
+	// Define ChainRetriever.
+	primary := mockRetriever{permanentFail: true}
+	secondary := mockRetriever{token: wantToken, expiresIn: time.Hour}
+	c := NewChainRetriever(log15.New("global", "backoff_test"), time.Hour,
+		ChainLink{Name: "primary", Retriever: &primary},
+		ChainLink{Name: "secondary", Retriever: &secondary},
+	)
+
+	// Test the results.
+	for i := 0; i < 2; i++ {
+		gotToken, gotErr := c.RetrieveTokenContext(context.Background())
+		if gotErr != nil {
+			t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+		}
+		if gotToken.Value != wantToken || gotToken.Source != wantSource {
+			t.Errorf("An unexpected token was returned. Want '%v' from '%v', Got '%+v'", wantToken, wantSource, gotToken)
+		}
+	}
+	if primary.called != wantPrimaryCalled {
+		t.Errorf("The primary was called an unexpected number of times. Want '%v', Got '%v'", wantPrimaryCalled, primary.called)
+	}
+	if secondary.called != wantSecondaryCalled {
+		t.Errorf("The secondary was called an unexpected number of times. Want '%v', Got '%v'", wantSecondaryCalled, secondary.called)
+	}
+}
+
+func TestChainRetrieverFailback(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantSources := []string{"secondary", "primary", "primary"}
+
+	// Define ChainRetriever.
+	primary := mockRetriever{numFails: 1, token: "primaryToken", expiresIn: time.Hour}
+	secondary := mockRetriever{token: "secondaryToken", expiresIn: time.Hour}
+	c := NewChainRetriever(log15.New("global", "backoff_test"), 0, // Probe the primary on every retrieval.
+		ChainLink{Name: "primary", Retriever: &primary},
+		ChainLink{Name: "secondary", Retriever: &secondary},
+	)
+
+	// Test the results.
+	for _, wantSource := range wantSources {
+		gotToken, gotErr := c.RetrieveTokenContext(context.Background())
+		if gotErr != nil {
+			t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+		}
+		if gotToken.Source != wantSource {
+			t.Errorf("An unexpected source was returned. Want '%v', Got '%v'", wantSource, gotToken.Source)
+		}
+	}
+}
+
+func TestChainRetrieverFailoverFromSecondary(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantSources := []string{"secondary", "primary"}
+	wantStaticCalled := 0
+
+	// Define ChainRetriever.
+	primary := mockRetriever{numFails: 1, token: "primaryToken", expiresIn: time.Hour}
+	secondary := mockRetriever{token: "secondaryToken", expiresIn: time.Hour}
+	static := mockRetriever{token: "staticToken", expiresIn: time.Hour}
+	c := NewChainRetriever(log15.New("global", "backoff_test"), time.Hour,
+		ChainLink{Name: "primary", Retriever: &primary},
+		ChainLink{Name: "secondary", Retriever: &secondary},
+		ChainLink{Name: "static", Retriever: &static},
+	)
+
+	// Test the results.
+	for i, wantSource := range wantSources {
+		if i > 0 {
+			secondary.permanentFail = true
+		}
+		gotToken, gotErr := c.RetrieveTokenContext(context.Background())
+		if gotErr != nil {
+			t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+		}
+		if gotToken.Source != wantSource {
+			t.Errorf("An unexpected source was returned. Want '%v', Got '%v'", wantSource, gotToken.Source)
+		}
+	}
+	if static.called != wantStaticCalled {
+		t.Errorf("The static credential was called before the primary. Want '%v', Got '%v'", wantStaticCalled, static.called)
+	}
+}
+
+func TestChainRetrieverAllFail(t *testing.T) {
+	t.Parallel()
+
+	// Define ChainRetrievers.
+	transient := NewChainRetriever(log15.New("global", "backoff_test"), time.Hour,
+		ChainLink{Name: "primary", Retriever: &mockRetriever{permanentFail: true, err: Permanent(errors.New("invalid_client"))}},
+		ChainLink{Name: "secondary", Retriever: &mockRetriever{permanentFail: true}},
+	)
+	permanent := NewChainRetriever(log15.New("global", "backoff_test"), time.Hour,
+		ChainLink{Name: "primary", Retriever: &mockRetriever{permanentFail: true, err: Permanent(errors.New("invalid_client"))}},
+	)
+
+	// Test the results.
+	_, gotErr := transient.RetrieveTokenContext(context.Background())
+	if gotErr == nil || IsPermanent(gotErr) || !errors.Is(gotErr, mockRetrieverErr) {
+		t.Errorf("An unexpected error occurred. Want a transient error wrapping '%v', Got '%v'", mockRetrieverErr, gotErr)
+	}
+	_, gotErr = permanent.RetrieveTokenContext(context.Background())
+	if !IsPermanent(gotErr) {
+		t.Errorf("An unexpected error occurred. Want a permanent error, Got '%v'", gotErr)
+	}
+}
+
+func TestRefreshInternalTokenSource(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "newToken123"
+	wantSource := "primary"
+
+	// Define tokenRefresher service.
+	m := tokenRefresher{
+		logger:        log15.New("global", "backoff_test"),
+		done:          make(chan struct{}),
+		force:         make(chan struct{}),
+		refreshBuffer: 5 * time.Minute,
+		retriever: NewChainRetriever(log15.New("global", "backoff_test"), time.Hour,
+			ChainLink{Name: "primary", Retriever: &mockRetriever{token: wantToken, expiresIn: time.Hour}},
+		),
+	}
+
+	// Test the results.
+	if _, gotErr := m.refresh(true); gotErr != nil {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+	}
+	gotToken, _ := m.Token()
+	if gotToken.Value != wantToken || gotToken.Source != wantSource {
+		t.Errorf("An unexpected token was returned. Want '%v' from '%v', Got '%+v'", wantToken, wantSource, gotToken)
+	}
+}
@@ -0,0 +1,133 @@
+package backoff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrorClassifier reports whether a retrieval error is permanent. Permanent
+// errors stop the refresher from retrying until Refresh is called or the
+// retriever is replaced; all other errors are retried with backoff.
+type ErrorClassifier func(err error) bool
+
+// permanentError marks an error as not worth retrying.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps err to signal that retrying the retrieval will not help,
+// e.g. because the client credentials are invalid. Permanent(nil) is nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err, or any error it wraps, was created with
+// Permanent. It is the default ErrorClassifier.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// RetryAfterError is implemented by retrieval errors that carry a hint from
+// the server, such as an HTTP Retry-After header, about how long to wait
+// before trying again.
+type RetryAfterError interface {
+	error
+	RetryAfter() time.Duration
+}
+
+// retryAfterError attaches a Retry-After hint to an error.
+type retryAfterError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+func (e *retryAfterError) RetryAfter() time.Duration {
+	return e.delay
+}
+
+// RetryAfter wraps err so that the refresher waits at least delay before the
+// next attempt. RetryAfter(nil, delay) is nil.
+func RetryAfter(err error, delay time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &retryAfterError{err: err, delay: delay}
+}
+
+// retryAfter returns the delay requested by err, or any error it wraps, if
+// one was given.
+func retryAfter(err error) (time.Duration, bool) {
+	var r RetryAfterError
+	if !errors.As(err, &r) || r.RetryAfter() <= 0 {
+		return 0, false
+	}
+	return r.RetryAfter(), true
+}
+
+// combineErrors reports the failure of several retrievers at once. The result
+// is permanent only if every error is permanent; otherwise it wraps the last
+// transient error, so that hints such as Retry-After are preserved without
+// the permanent errors being mistaken for the whole.
+func combineErrors(msg string, errs []error) error {
+	msgs := make([]string, 0, len(errs))
+	var transient error
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+		if !IsPermanent(err) {
+			transient = err
+		}
+	}
+	msg += ": " + strings.Join(msgs, "; ")
+
+	if transient == nil {
+		return Permanent(errors.New(msg))
+	}
+	return &combinedError{msg: msg, err: transient}
+}
+
+// combinedError is the error returned by combineErrors.
+type combinedError struct {
+	msg string
+	err error
+}
+
+func (e *combinedError) Error() string {
+	return e.msg
+}
+
+func (e *combinedError) Unwrap() error {
+	return e.err
+}
+
+// PanicError is returned in place of a panic raised by a TokenRetriever, so
+// that the panic counts as a failed attempt.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("token retriever panicked: %v", e.Value)
+}
@@ -0,0 +1,91 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPermanent(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantErr := mockRetrieverErr
+
+	// Test the results.
+	gotErr := Permanent(wantErr)
+	if !IsPermanent(gotErr) {
+		t.Errorf("The error was not classified as permanent. Got '%v'", gotErr)
+	}
+	if !errors.Is(gotErr, wantErr) {
+		t.Errorf("The wrapped error was not preserved. Want '%v', Got '%v'", wantErr, gotErr)
+	}
+	if gotErr.Error() != wantErr.Error() {
+		t.Errorf("An unexpected error message was returned. Want '%v', Got '%v'", wantErr.Error(), gotErr.Error())
+	}
+	if wrapped := fmt.Errorf("retrieve: %w", gotErr); !IsPermanent(wrapped) {
+		t.Errorf("A wrapped permanent error was not classified as permanent. Got '%v'", wrapped)
+	}
+}
+
+func TestPermanentNil(t *testing.T) {
+	t.Parallel()
+
+	// Test the results.
+	if gotErr := Permanent(nil); gotErr != nil {
+		t.Errorf("An unexpected error was returned. Want '%v', Got '%v'", nil, gotErr)
+	}
+	if IsPermanent(nil) {
+		t.Errorf("A nil error was classified as permanent")
+	}
+	if IsPermanent(mockRetrieverErr) {
+		t.Errorf("A transient error was classified as permanent. Got '%v'", mockRetrieverErr)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantDelay := 30 * time.Second
+
+	// Test the results.
+	err := fmt.Errorf("retrieve: %w", RetryAfter(mockRetrieverErr, wantDelay))
+	gotDelay, ok := retryAfter(err)
+	if !ok || gotDelay != wantDelay {
+		t.Errorf("An unexpected delay was returned. Want '%v', Got '%v'", wantDelay, gotDelay)
+	}
+	if !errors.Is(err, mockRetrieverErr) {
+		t.Errorf("The wrapped error was not preserved. Want '%v', Got '%v'", mockRetrieverErr, err)
+	}
+	if _, ok := retryAfter(mockRetrieverErr); ok {
+		t.Errorf("A delay was returned for an error without a hint")
+	}
+	if gotErr := RetryAfter(nil, wantDelay); gotErr != nil {
+		t.Errorf("An unexpected error was returned. Want '%v', Got '%v'", nil, gotErr)
+	}
+}
+
+func TestRetrieveContextPanic(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantValue := "retriever panic"
+
+	// Test the results.
+	_, _, gotErr := retrieveContext(context.Background(), RetrieverFunc(func(ctx context.Context) (Token, error) {
+		panic(wantValue)
+	}))
+	var p *PanicError
+	if !errors.As(gotErr, &p) {
+		t.Fatalf("The panic was not converted to an error. Got '%v'", gotErr)
+	}
+	if p.Value != wantValue || len(p.Stack) == 0 {
+		t.Errorf("An unexpected panic error was returned. Want '%v' with a stack, Got '%v'", wantValue, p.Value)
+	}
+	if IsPermanent(gotErr) {
+		t.Errorf("A panic was classified as permanent")
+	}
+}
@@ -0,0 +1,244 @@
+package backoff
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultExecTimeout limits how long a credential helper may run by default.
+const defaultExecTimeout = 30 * time.Second
+
+// ErrRetrieverClosed is returned by retrievers that have been closed.
+var ErrRetrieverClosed = errors.New("token retriever closed")
+
+// ExitCodeAction is how an ExecRetriever treats a non-zero exit code.
+type ExitCodeAction int
+
+const (
+	// ExitTransient makes the refresher retry with backoff.
+	ExitTransient ExitCodeAction = iota
+
+	// ExitPermanent makes the refresher stop retrying, e.g. because the
+	// helper needs the user to log in.
+	ExitPermanent
+)
+
+// ExecOption configures optional behavior of an ExecRetriever.
+type ExecOption func(*ExecRetriever)
+
+// WithExecTimeout limits how long the command may run. It defaults to 30
+// seconds.
+func WithExecTimeout(timeout time.Duration) ExecOption {
+	return func(r *ExecRetriever) {
+		r.timeout = timeout
+	}
+}
+
+// WithExecEnv adds "key=value" variables to the command's environment, which
+// is otherwise inherited.
+func WithExecEnv(env ...string) ExecOption {
+	return func(r *ExecRetriever) {
+		r.env = append(r.env, env...)
+	}
+}
+
+// WithExecStdin sets what is written to the command's standard input.
+func WithExecStdin(stdin []byte) ExecOption {
+	return func(r *ExecRetriever) {
+		r.stdin = stdin
+	}
+}
+
+// WithExecExitCodes sets how non-zero exit codes are treated. Codes that aren't
+// mapped are transient.
+func WithExecExitCodes(codes map[int]ExitCodeAction) ExecOption {
+	return func(r *ExecRetriever) {
+		r.exitCodes = codes
+	}
+}
+
+// ExecError is returned when the command exits with a non-zero code.
+type ExecError struct {
+	ExitCode int
+	Stderr   string
+}
+
+func (e *ExecError) Error() string {
+	msg := fmt.Sprintf("credential helper exited with code %d", e.ExitCode)
+	if e.Stderr != "" {
+		msg += ": " + e.Stderr
+	}
+	return msg
+}
+
+// ExecRetriever retrieves tokens from an external credential helper, in the
+// way git and docker use credential helpers. The command must print a JSON
+// object to standard output:
+//
+//	{"token": "...", "expires_in": 3600}
+//
+// or, with an absolute expiry as RFC 3339 or seconds since the epoch:
+//
+//	{"token": "...", "expires_at": "2024-01-02T15:04:05Z"}
+//
+// The command runs in its own process group, which is killed if it times out,
+// if the retrieval is cancelled or if the retriever is closed.
+type ExecRetriever struct {
+	path string
+	args []string
+
+	timeout   time.Duration
+	env       []string
+	stdin     []byte
+	exitCodes map[int]ExitCodeAction
+
+	mu      sync.Mutex
+	closed  bool
+	running map[*exec.Cmd]struct{}
+}
+
+// NewExecRetriever creates an ExecRetriever that runs path with args.
+func NewExecRetriever(path string, args []string, opts ...ExecOption) *ExecRetriever {
+	r := ExecRetriever{
+		path:    path,
+		args:    args,
+		timeout: defaultExecTimeout,
+		running: make(map[*exec.Cmd]struct{}),
+	}
+	for _, opt := range opts {
+		opt(&r)
+	}
+	return &r
+}
+
+// RetrieveToken implements TokenRetriever.
+func (r *ExecRetriever) RetrieveToken() (token string, expiresIn time.Duration, err error) {
+	t, expiresIn, err := retrieveContext(context.Background(), r)
+	return t.Value, expiresIn, err
+}
+
+// execOutput is the output of a credential helper.
+type execOutput struct {
+	Token     string          `json:"token"`
+	ExpiresIn *float64        `json:"expires_in"`
+	ExpiresAt json.RawMessage `json:"expires_at"`
+}
+
+// RetrieveTokenContext implements ContextRetriever.
+func (r *ExecRetriever) RetrieveTokenContext(ctx context.Context) (Token, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, r.path, r.args...)
+	cmd.Env = append(os.Environ(), r.env...)
+	cmd.Stdin = bytes.NewReader(r.stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd)
+	}
+	cmd.WaitDelay = time.Second // Don't wait for grandchildren holding the pipes open.
+
+	if err := r.start(cmd); err != nil {
+		return Token{}, err
+	}
+	err := cmd.Wait()
+	if closed := r.finish(cmd); closed {
+		return Token{}, Permanent(ErrRetrieverClosed)
+	}
+	if ctx.Err() != nil {
+		return Token{}, fmt.Errorf("credential helper %s: %w", r.path, ctx.Err())
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		e := &ExecError{ExitCode: exitErr.ExitCode(), Stderr: strings.TrimSpace(stderr.String())}
+		if r.exitCodes[e.ExitCode] == ExitPermanent {
+			return Token{}, Permanent(e)
+		}
+		return Token{}, e
+	}
+	if err != nil {
+		return Token{}, fmt.Errorf("credential helper %s: %w", r.path, err)
+	}
+
+	return parseExecOutput(stdout.Bytes(), time.Now())
+}
+
+// start starts cmd, unless the retriever is closed.
+func (r *ExecRetriever) start(cmd *exec.Cmd) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return Permanent(ErrRetrieverClosed)
+	}
+	if err := cmd.Start(); err != nil {
+		return Permanent(fmt.Errorf("credential helper %s: %w", r.path, err))
+	}
+	r.running[cmd] = struct{}{}
+	return nil
+}
+
+// finish forgets cmd once it has exited, and reports whether the retriever
+// has been closed.
+func (r *ExecRetriever) finish(cmd *exec.Cmd) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.running, cmd)
+	return r.closed
+}
+
+// Close kills the process groups of any commands running, and makes further
+// retrievals fail permanently.
+func (r *ExecRetriever) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	for cmd := range r.running {
+		killProcessGroup(cmd)
+	}
+	return nil
+}
+
+// parseExecOutput parses the output of a credential helper run at now.
+func parseExecOutput(data []byte, now time.Time) (Token, error) {
+	var out execOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return Token{}, fmt.Errorf("parsing credential helper output failed: %w", err)
+	}
+	if out.Token == "" {
+		return Token{}, errors.New("credential helper output has no token")
+	}
+
+	token := Token{Value: out.Token}
+	switch {
+	case out.ExpiresIn != nil:
+		token.Expiry = now.Add(time.Duration(*out.ExpiresIn * float64(time.Second)))
+	case len(out.ExpiresAt) > 0:
+		var s string
+		var epoch float64
+		if err := json.Unmarshal(out.ExpiresAt, &s); err == nil {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return Token{}, fmt.Errorf("parsing credential helper expires_at failed: %w", err)
+			}
+			token.Expiry = t
+		} else if err := json.Unmarshal(out.ExpiresAt, &epoch); err == nil {
+			token.Expiry = time.Unix(0, int64(epoch*float64(time.Second)))
+		} else {
+			return Token{}, fmt.Errorf("credential helper expires_at is neither RFC 3339 nor a number: %s", out.ExpiresAt)
+		}
+	default:
+		return Token{}, errors.New("credential helper output has neither expires_in nor expires_at")
+	}
+	return token, nil
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package backoff
+
+import "os/exec"
+
+// setProcessGroup is a no-op where process groups aren't supported.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills cmd, but not the processes it started, where process
+// groups aren't supported.
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,143 @@
+//go:build unix
+
+package backoff
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// shell returns an ExecRetriever running script with sh.
+func shell(script string, opts ...ExecOption) *ExecRetriever {
+	return NewExecRetriever("/bin/sh", []string{"-c", script}, opts...)
+}
+
+func TestExecRetriever(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		r             *ExecRetriever
+		wantToken     string
+		wantExpiresIn time.Duration
+	}{
+		{
+			"expires_in",
+			shell(`echo '{"token":"execToken123","expires_in":3600}'`),
+			"execToken123",
+			time.Hour,
+		},
+		{
+			"expires_at RFC 3339",
+			shell(`echo "{\"token\":\"execToken123\",\"expires_at\":\"$(date -u -d @$(($(date +%s)+600)) +%Y-%m-%dT%H:%M:%SZ)\"}"`),
+			"execToken123",
+			10 * time.Minute,
+		},
+		{
+			"expires_at epoch",
+			shell(`echo "{\"token\":\"execToken123\",\"expires_at\":$(($(date +%s)+600))}"`),
+			"execToken123",
+			10 * time.Minute,
+		},
+		{
+			"env and stdin",
+			shell(`read host; printf '{"token":"%s-%s-%s","expires_in":60}' "$host" "$TOKEN_SCOPE" "$TOKEN_AUDIENCE"`, WithExecEnv("TOKEN_SCOPE=read"), WithExecEnv("TOKEN_AUDIENCE=registry"), WithExecStdin([]byte("registry.example.com\n"))),
+			"registry.example.com-read-registry",
+			time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		// Test the results.
+		gotToken, gotExpiresIn, gotErr := retrieveContext(context.Background(), tt.r)
+		if gotErr != nil {
+			t.Errorf("%v: An unexpected error occurred. Want '%v', Got '%v'", tt.name, nil, gotErr)
+		}
+		if gotToken.Value != tt.wantToken {
+			t.Errorf("%v: An unexpected token was returned. Want '%v', Got '%v'", tt.name, tt.wantToken, gotToken.Value)
+		}
+		if gotExpiresIn > tt.wantExpiresIn || gotExpiresIn < tt.wantExpiresIn-5*time.Second {
+			t.Errorf("%v: An unexpected expiry was returned. Want '%v', Got '%v'", tt.name, tt.wantExpiresIn, gotExpiresIn)
+		}
+	}
+}
+
+func TestExecRetrieverExitCodes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		exitCode      string
+		wantPermanent bool
+	}{
+		{"1", false},
+		{"3", true},
+	}
+
+	for _, tt := range tests {
+		// Define ExecRetriever.
+		r := shell("echo 'login required' >&2; exit "+tt.exitCode, WithExecExitCodes(map[int]ExitCodeAction{3: ExitPermanent}))
+
+		// Test the results.
+		_, gotErr := r.RetrieveTokenContext(context.Background())
+		var execErr *ExecError
+		if !errors.As(gotErr, &execErr) || execErr.Stderr != "login required" {
+			t.Errorf("An unexpected error occurred. Want an ExecError, Got '%v'", gotErr)
+		}
+		if gotPermanent := IsPermanent(gotErr); gotPermanent != tt.wantPermanent {
+			t.Errorf("Exit code %v was misclassified. Want permanent '%v', Got '%v'", tt.exitCode, tt.wantPermanent, gotPermanent)
+		}
+	}
+}
+
+func TestExecRetrieverTimeout(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantErr := context.DeadlineExceeded
+	maxDelay := 2 * time.Second
+
+	// Define ExecRetriever.
+	r := shell("sleep 10 & sleep 10", WithExecTimeout(100*time.Millisecond)) // The background sleep holds stdout open.
+
+	// Test the results.
+	start := time.Now()
+	_, gotErr := r.RetrieveTokenContext(context.Background())
+	if !errors.Is(gotErr, wantErr) {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+	}
+	if gotDelay := time.Since(start); gotDelay > maxDelay {
+		t.Errorf("The command was not killed in time. Want less than '%v', Got '%v'", maxDelay, gotDelay)
+	}
+}
+
+func TestExecRetrieverClose(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantErr := ErrRetrieverClosed
+	maxDelay := 2 * time.Second
+
+	// Define ExecRetriever.
+	r := shell("sleep 10 & sleep 10")
+
+	// Test the results.
+	start := time.Now()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		r.Close()
+	}()
+	_, gotErr := r.RetrieveTokenContext(context.Background())
+	if !IsPermanent(gotErr) || !errors.Is(gotErr, wantErr) {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+	}
+	if gotDelay := time.Since(start); gotDelay > maxDelay {
+		t.Errorf("The process group was not killed in time. Want less than '%v', Got '%v'", maxDelay, gotDelay)
+	}
+
+	_, gotErr = r.RetrieveTokenContext(context.Background())
+	if !errors.Is(gotErr, wantErr) {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+	}
+}
@@ -0,0 +1,154 @@
+package backoff
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileOption configures optional behavior of a FileRetriever.
+type FileOption func(*FileRetriever)
+
+// WithFileTTL sets how long tokens that aren't JWTs with an exp claim are
+// considered valid after being read. Without it, such tokens are rejected.
+func WithFileTTL(ttl time.Duration) FileOption {
+	return func(r *FileRetriever) {
+		r.ttl = ttl
+	}
+}
+
+// FileRetriever reads tokens from a file, such as a Kubernetes projected
+// service account token that the kubelet rotates on disk. The expiry is taken
+// from the exp claim of JWTs, or is the configured TTL.
+//
+// Call Watch to refresh as soon as the file changes.
+type FileRetriever struct {
+	path string
+	ttl  time.Duration
+
+	mu   sync.Mutex
+	read fileVersion // Version of the file as of the latest read.
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewFileRetriever creates a FileRetriever reading path.
+func NewFileRetriever(path string, opts ...FileOption) *FileRetriever {
+	r := FileRetriever{
+		path: path,
+		done: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&r)
+	}
+	return &r
+}
+
+// RetrieveToken implements TokenRetriever.
+func (r *FileRetriever) RetrieveToken() (token string, expiresIn time.Duration, err error) {
+	t, expiresIn, err := retrieveContext(context.Background(), r)
+	return t.Value, expiresIn, err
+}
+
+// RetrieveTokenContext implements ContextRetriever. A missing or empty file is
+// a transient error, since it may be in the middle of being rotated.
+func (r *FileRetriever) RetrieveTokenContext(ctx context.Context) (Token, error) {
+	version := statFile(r.path)
+	r.mu.Lock()
+	r.read = version
+	r.mu.Unlock()
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return Token{}, fmt.Errorf("reading token file failed: %w", err)
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return Token{}, fmt.Errorf("token file %s is empty", r.path)
+	}
+
+	token := Token{Value: value, Source: r.path}
+	if claims, err := parseJWTClaims(value); err == nil {
+		token.Claims = claims
+		if exp, ok := claims["exp"].(float64); ok {
+			token.Expiry = time.Unix(int64(exp), 0)
+			return token, nil
+		}
+	}
+	if r.ttl <= 0 {
+		return Token{}, Permanent(fmt.Errorf("token file %s has no exp claim and no TTL is configured", r.path))
+	}
+	token.Expiry = time.Now().Add(r.ttl)
+	return token, nil
+}
+
+// Watch polls the file every interval, and calls refresher.Refresh whenever
+// it has changed since it was last read. Changes are detected by stat, so
+// that rotation by swapping a symlink, e.g. a ..data directory, is detected
+// as well as writes to the file. Watch returns immediately; polling stops
+// when the retriever is closed.
+func (r *FileRetriever) Watch(refresher TokenRefresher, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.mu.Lock()
+				read := r.read
+				r.mu.Unlock()
+				// Keep asking until the new version is read, in case the
+				// refresher was busy.
+				if !statFile(r.path).equal(read) {
+					refresher.Refresh("token file changed")
+				}
+			case <-r.done:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops watching the file. It can be called more than once.
+func (r *FileRetriever) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+	return nil
+}
+
+// fileVersion identifies the contents of a file, as far as stat can tell.
+type fileVersion struct {
+	resolved string // Path after following symlinks.
+	info     os.FileInfo
+}
+
+// statFile returns the current version of the file at path. Missing files
+// have a zero version.
+func statFile(path string) fileVersion {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fileVersion{}
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return fileVersion{}
+	}
+	return fileVersion{resolved: resolved, info: info}
+}
+
+// equal reports whether v and o are the same version of a file.
+func (v fileVersion) equal(o fileVersion) bool {
+	if v.info == nil || o.info == nil {
+		return v.info == nil && o.info == nil
+	}
+	return v.resolved == o.resolved &&
+		os.SameFile(v.info, o.info) &&
+		v.info.ModTime().Equal(o.info.ModTime()) &&
+		v.info.Size() == o.info.Size()
+}
@@ -0,0 +1,157 @@
+package backoff
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+func TestFileRetriever(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	exp := time.Now().Add(10 * time.Minute).Unix()
+	jwt := "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"system:serviceaccount:default:app","exp":%d}`, exp))) + "."
+
+	tests := []struct {
+		name          string
+		contents      string
+		ttl           time.Duration
+		wantToken     string
+		wantExpiresIn time.Duration
+		wantPermanent bool
+	}{
+		{"JWT", jwt + "\n", 0, jwt, 10 * time.Minute, false},
+		{"JWT with TTL", jwt, time.Hour, jwt, 10 * time.Minute, false},
+		{"opaque with TTL", "opaqueToken123\n", time.Hour, "opaqueToken123", time.Hour, false},
+		{"opaque without TTL", "opaqueToken123", 0, "", 0, true},
+	}
+
+	for _, tt := range tests {
+		// Define FileRetriever.
+		path := filepath.Join(t.TempDir(), "token")
+		if err := os.WriteFile(path, []byte(tt.contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		r := NewFileRetriever(path, WithFileTTL(tt.ttl))
+
+		// Test the results.
+		gotToken, gotExpiresIn, gotErr := retrieveContext(context.Background(), r)
+		if gotPermanent := IsPermanent(gotErr); gotPermanent != tt.wantPermanent {
+			t.Errorf("%v: An unexpected error occurred. Want permanent '%v', Got '%v'", tt.name, tt.wantPermanent, gotErr)
+		}
+		if gotToken.Value != tt.wantToken {
+			t.Errorf("%v: An unexpected token was returned. Want '%v', Got '%v'", tt.name, tt.wantToken, gotToken.Value)
+		}
+		if gotExpiresIn > tt.wantExpiresIn || gotExpiresIn < tt.wantExpiresIn-2*time.Second {
+			t.Errorf("%v: An unexpected expiry was returned. Want '%v', Got '%v'", tt.name, tt.wantExpiresIn, gotExpiresIn)
+		}
+	}
+}
+
+func TestFileRetrieverMissing(t *testing.T) {
+	t.Parallel()
+
+	// Define FileRetriever.
+	r := NewFileRetriever(filepath.Join(t.TempDir(), "token"), WithFileTTL(time.Hour))
+
+	// Test the results.
+	_, gotErr := r.RetrieveTokenContext(context.Background())
+	if gotErr == nil || IsPermanent(gotErr) {
+		t.Errorf("An unexpected error occurred. Want a transient error, Got '%v'", gotErr)
+	}
+}
+
+func TestFileRetrieverWatch(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantTokens := []string{"token1", "token2"}
+
+	// Define FileRetriever.
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte(wantTokens[0]), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r := NewFileRetriever(path, WithFileTTL(time.Hour))
+	defer r.Close()
+	m := NewTokenRefresher(log15.New("global", "backoff_test"), time.Minute, r)
+	defer m.Close()
+	r.Watch(m, 10*time.Millisecond)
+
+	// Test the results.
+	for i, wantToken := range wantTokens {
+		if i > 0 {
+			if err := os.WriteFile(path, []byte(wantToken), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+
+		gotToken, gotErr := m.GetToken()
+		if gotErr != nil {
+			t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+		}
+		if gotToken != wantToken {
+			t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken)
+		}
+	}
+}
+
+func TestFileRetrieverWatchSymlinkSwap(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantTokens := []string{"token1", "token2"}
+
+	// Define FileRetriever, laid out like a Kubernetes projected volume.
+	dir := t.TempDir()
+	writeVersion := func(version, token string) {
+		versionDir := filepath.Join(dir, version)
+		if err := os.Mkdir(versionDir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(versionDir, "token"), []byte(token), 0600); err != nil {
+			t.Fatal(err)
+		}
+		// Swap ..data atomically, as the kubelet does.
+		if err := os.Symlink(version, filepath.Join(dir, "..data_tmp")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeVersion("..v1", wantTokens[0])
+	path := filepath.Join(dir, "token")
+	if err := os.Symlink(filepath.Join("..data", "token"), path); err != nil {
+		t.Fatal(err)
+	}
+	r := NewFileRetriever(path, WithFileTTL(time.Hour))
+	defer r.Close()
+	m := NewTokenRefresher(log15.New("global", "backoff_test"), time.Minute, r)
+	defer m.Close()
+	r.Watch(m, 10*time.Millisecond)
+
+	// Test the results.
+	for i, wantToken := range wantTokens {
+		if i > 0 {
+			writeVersion(fmt.Sprintf("..v%d", i+1), wantToken)
+		}
+		time.Sleep(100 * time.Millisecond)
+
+		gotToken, gotErr := m.GetToken()
+		if gotErr != nil {
+			t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+		}
+		if gotToken != wantToken {
+			t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package backoff
+
+import (
+	"context"
+	"time"
+)
+
+// HedgedRetriever cuts the tail latency of token retrieval by racing two
+// redundant endpoints. It calls the primary retriever and, if it hasn't
+// answered within the hedge delay, also calls the alternate. The first
+// success wins and the other call's context is cancelled.
+//
+// If the primary fails before the delay has elapsed, the alternate is called
+// straight away.
+type HedgedRetriever struct {
+	primary   TokenRetriever
+	alternate TokenRetriever
+	delay     time.Duration
+}
+
+// NewHedgedRetriever creates a HedgedRetriever that calls alternate once
+// primary has taken longer than delay.
+func NewHedgedRetriever(primary, alternate TokenRetriever, delay time.Duration) *HedgedRetriever {
+	return &HedgedRetriever{
+		primary:   primary,
+		alternate: alternate,
+		delay:     delay,
+	}
+}
+
+// RetrieveToken implements TokenRetriever.
+func (h *HedgedRetriever) RetrieveToken() (token string, expiresIn time.Duration, err error) {
+	t, expiresIn, err := retrieveContext(context.Background(), h)
+	return t.Value, expiresIn, err
+}
+
+// hedgedResult is the outcome of one of the hedged calls.
+type hedgedResult struct {
+	token Token
+	err   error
+}
+
+// RetrieveTokenContext implements ContextRetriever. Retrievers that don't
+// implement ContextRetriever can't be cancelled; their late results are
+// discarded.
+func (h *HedgedRetriever) RetrieveTokenContext(ctx context.Context) (Token, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Cancels the losing call.
+
+	results := make(chan hedgedResult, 2)
+	call := func(r TokenRetriever) {
+		go func() {
+			token, _, err := retrieveContext(ctx, r)
+			results <- hedgedResult{token: token, err: err}
+		}()
+	}
+
+	call(h.primary)
+	pending, hedged := 1, false
+	timer := time.NewTimer(h.delay)
+	defer timer.Stop()
+
+	var errs []error
+	for {
+		select {
+		case <-timer.C:
+			if !hedged {
+				hedged = true
+				pending++
+				call(h.alternate)
+			}
+
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				return res.token, nil
+			}
+			errs = append(errs, res.err)
+			if !hedged {
+				hedged = true
+				pending++
+				call(h.alternate)
+			} else if pending == 0 {
+				return Token{}, combineErrors("hedged token retrieval failed", errs)
+			}
+
+		case <-ctx.Done():
+			return Token{}, ctx.Err()
+		}
+	}
+}
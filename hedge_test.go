@@ -0,0 +1,130 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowRetriever is a context aware retriever that takes delay to answer.
+type slowRetriever struct {
+	token string
+	delay time.Duration
+	err   error
+
+	cancelled chan struct{} // Closed the first time a call is cancelled.
+	once      sync.Once
+}
+
+func (r *slowRetriever) RetrieveToken() (token string, expiresIn time.Duration, err error) {
+	t, err := r.RetrieveTokenContext(context.Background())
+	return t.Value, time.Hour, err
+}
+
+func (r *slowRetriever) RetrieveTokenContext(ctx context.Context) (Token, error) {
+	select {
+	case <-time.After(r.delay):
+	case <-ctx.Done():
+		if r.cancelled != nil {
+			r.once.Do(func() { close(r.cancelled) })
+		}
+		return Token{}, ctx.Err()
+	}
+	if r.err != nil {
+		return Token{}, r.err
+	}
+	return Token{Value: r.token, Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+func TestHedgedRetrieverPrimaryFast(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "primaryToken"
+
+	// Define HedgedRetriever.
+	primary := slowRetriever{token: wantToken, delay: 10 * time.Millisecond}
+	alternate := mockRetriever{token: "alternateToken", expiresIn: time.Hour}
+	h := NewHedgedRetriever(&primary, &alternate, time.Second)
+
+	// Test the results.
+	gotToken, _, gotErr := h.RetrieveToken()
+	if gotErr != nil {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+	}
+	if gotToken != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken)
+	}
+	if alternate.called != 0 {
+		t.Errorf("The alternate was called an unexpected number of times. Want '%v', Got '%v'", 0, alternate.called)
+	}
+}
+
+func TestHedgedRetrieverPrimarySlow(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "alternateToken"
+	maxDelay := 500 * time.Millisecond
+
+	// Define HedgedRetriever.
+	primary := slowRetriever{token: "primaryToken", delay: time.Minute, cancelled: make(chan struct{})}
+	alternate := slowRetriever{token: wantToken, delay: 10 * time.Millisecond}
+	h := NewHedgedRetriever(&primary, &alternate, 50*time.Millisecond)
+
+	// Test the results.
+	start := time.Now()
+	gotToken, gotErr := h.RetrieveTokenContext(context.Background())
+	if gotErr != nil {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+	}
+	if gotToken.Value != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken.Value)
+	}
+	if gotDelay := time.Since(start); gotDelay > maxDelay {
+		t.Errorf("The alternate was not hedged in time. Want less than '%v', Got '%v'", maxDelay, gotDelay)
+	}
+	select {
+	case <-primary.cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("The losing primary call was not cancelled")
+	}
+}
+
+func TestHedgedRetrieverPrimaryFails(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "alternateToken"
+
+	// Define HedgedRetriever.
+	primary := mockRetriever{permanentFail: true}
+	alternate := mockRetriever{token: wantToken, expiresIn: time.Hour}
+	h := NewHedgedRetriever(&primary, &alternate, time.Minute) // The alternate is called as soon as the primary fails.
+
+	// Test the results.
+	gotToken, gotErr := h.RetrieveTokenContext(context.Background())
+	if gotErr != nil {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+	}
+	if gotToken.Value != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken.Value)
+	}
+}
+
+func TestHedgedRetrieverBothFail(t *testing.T) {
+	t.Parallel()
+
+	// Define HedgedRetriever.
+	primary := mockRetriever{permanentFail: true, err: Permanent(errors.New("invalid_client"))}
+	alternate := mockRetriever{permanentFail: true}
+	h := NewHedgedRetriever(&primary, &alternate, time.Minute)
+
+	// Test the results.
+	_, gotErr := h.RetrieveTokenContext(context.Background())
+	if gotErr == nil || IsPermanent(gotErr) || !errors.Is(gotErr, mockRetrieverErr) {
+		t.Errorf("An unexpected error occurred. Want a transient error wrapping '%v', Got '%v'", mockRetrieverErr, gotErr)
+	}
+}
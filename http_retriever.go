@@ -0,0 +1,315 @@
+package backoff
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ExpiryFormat is how an expiry selected from a response is encoded.
+type ExpiryFormat int
+
+const (
+	// ExpirySeconds is a lifetime in seconds.
+	ExpirySeconds ExpiryFormat = iota
+
+	// ExpiryRFC3339 is an absolute time in RFC 3339 format.
+	ExpiryRFC3339
+
+	// ExpiryEpoch is an absolute time in seconds since the Unix epoch.
+	ExpiryEpoch
+)
+
+// HTTPOption configures optional behavior of an HTTPRetriever.
+type HTTPOption func(*HTTPRetriever)
+
+// WithHTTPHeader adds a header to each request.
+func WithHTTPHeader(key, value string) HTTPOption {
+	return func(r *HTTPRetriever) {
+		r.header.Add(key, value)
+	}
+}
+
+// WithHTTPBody sets the request body to the text/template tmpl, executed with
+// data for each request.
+func WithHTTPBody(tmpl string, data interface{}) HTTPOption {
+	return func(r *HTTPRetriever) {
+		r.bodyTemplate = tmpl
+		r.bodyData = data
+	}
+}
+
+// WithHTTPExpirySelector selects the token's expiry from the response with the
+// selector path, in format. See HTTPRetriever for the selector syntax.
+func WithHTTPExpirySelector(path string, format ExpiryFormat) HTTPOption {
+	return func(r *HTTPRetriever) {
+		r.expiryPath = path
+		r.expiryFormat = format
+	}
+}
+
+// WithHTTPCacheControlExpiry derives the token's expiry from the max-age of the
+// response's Cache-Control header. If an expiry is selected too, the earlier
+// one is used.
+func WithHTTPCacheControlExpiry() HTTPOption {
+	return func(r *HTTPRetriever) {
+		r.cacheControl = true
+	}
+}
+
+// WithHTTPRetrieverClient sets the HTTP client used for requests. It defaults
+// to http.DefaultClient.
+func WithHTTPRetrieverClient(client *http.Client) HTTPOption {
+	return func(r *HTTPRetriever) {
+		r.client = client
+	}
+}
+
+// HTTPError is returned when the endpoint responds with an error status.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("token endpoint returned %d", e.StatusCode)
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+// HTTPRetriever retrieves tokens from an ad-hoc JSON API. The token and its
+// expiry are selected from the response with paths of dot separated object
+// keys and [n] array indices, optionally starting with "$", e.g.
+// "$.data.credentials[0].token".
+//
+// Responses with status 408, 429 or 5xx are transient errors that honor
+// Retry-After; other error statuses are permanent. A response without an
+// expiry is an error.
+type HTTPRetriever struct {
+	method    string
+	url       string
+	tokenPath string
+
+	header       http.Header
+	bodyTemplate string
+	bodyData     interface{}
+	body         *template.Template
+	expiryPath   string
+	expiryFormat ExpiryFormat
+	cacheControl bool
+	client       *http.Client
+}
+
+// NewHTTPRetriever creates an HTTPRetriever that sends method requests to url
+// and selects the token with tokenPath. It returns an error if the body
+// template doesn't parse.
+func NewHTTPRetriever(method, url, tokenPath string, opts ...HTTPOption) (*HTTPRetriever, error) {
+	r := HTTPRetriever{
+		method:    method,
+		url:       url,
+		tokenPath: tokenPath,
+		header:    make(http.Header),
+		client:    http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(&r)
+	}
+
+	if r.bodyTemplate != "" {
+		body, err := template.New("body").Parse(r.bodyTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("parsing body template failed: %w", err)
+		}
+		r.body = body
+	}
+	return &r, nil
+}
+
+// RetrieveToken implements TokenRetriever.
+func (r *HTTPRetriever) RetrieveToken() (token string, expiresIn time.Duration, err error) {
+	t, expiresIn, err := retrieveContext(context.Background(), r)
+	return t.Value, expiresIn, err
+}
+
+// RetrieveTokenContext implements ContextRetriever.
+func (r *HTTPRetriever) RetrieveTokenContext(ctx context.Context) (Token, error) {
+	var body io.Reader
+	if r.body != nil {
+		var buf bytes.Buffer
+		if err := r.body.Execute(&buf, r.bodyData); err != nil {
+			return Token{}, Permanent(fmt.Errorf("executing body template failed: %w", err))
+		}
+		body = &buf
+	}
+
+	req, err := http.NewRequestWithContext(ctx, r.method, r.url, body)
+	if err != nil {
+		return Token{}, Permanent(err)
+	}
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return Token{}, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxOAuthResponse))
+	if err != nil {
+		return Token{}, fmt.Errorf("reading token response failed: %w", err)
+	}
+	received := time.Now()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return Token{}, httpError(resp, data)
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return Token{}, fmt.Errorf("parsing token response failed: %w", err)
+	}
+	value, err := selectJSON(doc, r.tokenPath)
+	if err != nil {
+		return Token{}, err
+	}
+	s, ok := value.(string)
+	if !ok || s == "" {
+		return Token{}, fmt.Errorf("token at %s is not a non-empty string", r.tokenPath)
+	}
+	token := Token{Value: s}
+
+	if r.expiryPath != "" {
+		value, err := selectJSON(doc, r.expiryPath)
+		if err != nil {
+			return Token{}, err
+		}
+		token.Expiry, err = parseExpiry(value, r.expiryFormat, received)
+		if err != nil {
+			return Token{}, fmt.Errorf("expiry at %s: %w", r.expiryPath, err)
+		}
+	}
+	if r.cacheControl {
+		if maxAge, ok := parseMaxAge(resp.Header.Get("Cache-Control")); ok {
+			if expiry := received.Add(maxAge); token.Expiry.IsZero() || expiry.Before(token.Expiry) {
+				token.Expiry = expiry
+			}
+		}
+	}
+	if token.Expiry.IsZero() {
+		return Token{}, errors.New("token response has no expiry")
+	}
+	return token, nil
+}
+
+// httpError converts an error response into an error classified for the
+// refresher.
+func httpError(resp *http.Response, body []byte) error {
+	e := &HTTPError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	if len(e.Body) > 200 {
+		e.Body = e.Body[:200] + "..."
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return RetryAfter(e, d)
+		}
+		return e
+	}
+	return Permanent(e)
+}
+
+// selectJSON returns the value at path in doc, a decoded JSON document.
+func selectJSON(doc interface{}, path string) (interface{}, error) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	v := doc
+	for rest != "" {
+		var key string
+		switch {
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("selector %s has an unterminated index", path)
+			}
+			i, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("selector %s has an invalid index: %w", path, err)
+			}
+			a, ok := v.([]interface{})
+			if !ok || i < 0 || i >= len(a) {
+				return nil, fmt.Errorf("no value at %s in token response", path)
+			}
+			v, rest = a[i], strings.TrimPrefix(rest[end+1:], ".")
+			continue
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key, rest = rest[:end], strings.TrimPrefix(rest[end:], ".")
+		}
+
+		o, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("no value at %s in token response", path)
+		}
+		if v, ok = o[key]; !ok {
+			return nil, fmt.Errorf("no value at %s in token response", path)
+		}
+	}
+	return v, nil
+}
+
+// parseExpiry converts a selected expiry in format to an absolute time, for a
+// response received at now. Numbers may also be given as strings.
+func parseExpiry(value interface{}, format ExpiryFormat, now time.Time) (time.Time, error) {
+	s, isString := value.(string)
+	if format == ExpiryRFC3339 {
+		if !isString {
+			return time.Time{}, fmt.Errorf("%v is not an RFC 3339 time", value)
+		}
+		return time.Parse(time.RFC3339, s)
+	}
+
+	n, ok := value.(float64)
+	if isString {
+		var err error
+		n, err = strconv.ParseFloat(s, 64)
+		ok = err == nil
+	}
+	if !ok {
+		return time.Time{}, fmt.Errorf("%v is not a number", value)
+	}
+	d := time.Duration(n * float64(time.Second))
+	if format == ExpiryEpoch {
+		return time.Unix(0, 0).Add(d), nil
+	}
+	return now.Add(d), nil
+}
+
+// parseMaxAge returns the max-age directive of a Cache-Control header.
+func parseMaxAge(cacheControl string) (time.Duration, bool) {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if !strings.EqualFold(name, "max-age") {
+			continue
+		}
+		secs, err := strconv.Atoi(strings.Trim(value, `"`))
+		if err != nil || secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	return 0, false
+}
@@ -0,0 +1,152 @@
+package backoff
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHTTPRetriever(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "httpToken123"
+	in10m := time.Now().Add(10 * time.Minute)
+
+	tests := []struct {
+		name          string
+		body          string
+		cacheControl  string
+		opts          []HTTPOption
+		wantExpiresIn time.Duration
+	}{
+		{
+			"seconds",
+			`{"data":{"credentials":[{"secret":"httpToken123","ttl":600}]}}`,
+			"",
+			[]HTTPOption{WithHTTPExpirySelector("$.data.credentials[0].ttl", ExpirySeconds)},
+			10 * time.Minute,
+		},
+		{
+			"RFC 3339",
+			`{"data":{"credentials":[{"secret":"httpToken123","expires":"` + in10m.UTC().Format(time.RFC3339) + `"}]}}`,
+			"",
+			[]HTTPOption{WithHTTPExpirySelector("data.credentials[0].expires", ExpiryRFC3339)},
+			10 * time.Minute,
+		},
+		{
+			"epoch",
+			`{"data":{"credentials":[{"secret":"httpToken123","exp":"` + strconv.FormatInt(in10m.Unix(), 10) + `"}]}}`,
+			"",
+			[]HTTPOption{WithHTTPExpirySelector("data.credentials[0].exp", ExpiryEpoch)},
+			10 * time.Minute,
+		},
+		{
+			"Cache-Control",
+			`{"data":{"credentials":[{"secret":"httpToken123"}]}}`,
+			"private, max-age=300",
+			[]HTTPOption{WithHTTPCacheControlExpiry()},
+			5 * time.Minute,
+		},
+		{
+			"Cache-Control before selected expiry",
+			`{"data":{"credentials":[{"secret":"httpToken123","ttl":600}]}}`,
+			"max-age=300",
+			[]HTTPOption{WithHTTPExpirySelector("$.data.credentials[0].ttl", ExpirySeconds), WithHTTPCacheControlExpiry()},
+			5 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		// Define HTTPRetriever.
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPut {
+				t.Errorf("%v: An unexpected method was used. Want '%v', Got '%v'", tt.name, http.MethodPut, r.Method)
+			}
+			if got := r.Header.Get("X-Api-Key"); got != "key123" {
+				t.Errorf("%v: An unexpected header was sent. Want '%v', Got '%v'", tt.name, "key123", got)
+			}
+			if got, _ := io.ReadAll(r.Body); string(got) != `{"role":"reader"}` {
+				t.Errorf("%v: An unexpected body was sent. Want '%v', Got '%v'", tt.name, `{"role":"reader"}`, string(got))
+			}
+			if tt.cacheControl != "" {
+				w.Header().Set("Cache-Control", tt.cacheControl)
+			}
+			w.Write([]byte(tt.body))
+		}))
+		opts := append([]HTTPOption{
+			WithHTTPHeader("X-Api-Key", "key123"),
+			WithHTTPBody(`{"role":"{{.Role}}"}`, struct{ Role string }{"reader"}),
+		}, tt.opts...)
+		r, err := NewHTTPRetriever(http.MethodPut, server.URL, "$.data.credentials[0].secret", opts...)
+		if err != nil {
+			t.Fatalf("%v: An unexpected error occurred. Want '%v', Got '%v'", tt.name, nil, err)
+		}
+
+		// Test the results.
+		gotToken, gotExpiresIn, gotErr := retrieveContext(context.Background(), r)
+		server.Close()
+		if gotErr != nil {
+			t.Errorf("%v: An unexpected error occurred. Want '%v', Got '%v'", tt.name, nil, gotErr)
+		}
+		if gotToken.Value != wantToken {
+			t.Errorf("%v: An unexpected token was returned. Want '%v', Got '%v'", tt.name, wantToken, gotToken.Value)
+		}
+		if gotExpiresIn > tt.wantExpiresIn || gotExpiresIn < tt.wantExpiresIn-2*time.Second {
+			t.Errorf("%v: An unexpected expiry was returned. Want '%v', Got '%v'", tt.name, tt.wantExpiresIn, gotExpiresIn)
+		}
+	}
+}
+
+func TestHTTPRetrieverErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		status         int
+		body           string
+		wantPermanent  bool
+		wantRetryAfter time.Duration
+	}{
+		{"unauthorized", http.StatusUnauthorized, `{"message":"bad key"}`, true, 0},
+		{"unavailable", http.StatusServiceUnavailable, `{"message":"try later"}`, false, 5 * time.Second},
+		{"missing token", http.StatusOK, `{"data":{}}`, false, 0},
+		{"missing expiry", http.StatusOK, `{"data":{"token":"httpToken123"}}`, false, 0},
+	}
+
+	for _, tt := range tests {
+		// Define HTTPRetriever.
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(tt.status)
+			w.Write([]byte(tt.body))
+		}))
+		r, _ := NewHTTPRetriever(http.MethodGet, server.URL, "data.token")
+
+		// Test the results.
+		_, gotErr := r.RetrieveTokenContext(context.Background())
+		server.Close()
+		if gotErr == nil {
+			t.Errorf("%v: An unexpected error occurred. Want an error, Got '%v'", tt.name, gotErr)
+		}
+		if gotPermanent := IsPermanent(gotErr); gotPermanent != tt.wantPermanent {
+			t.Errorf("%v: The error was misclassified. Want permanent '%v', Got '%v'", tt.name, tt.wantPermanent, gotPermanent)
+		}
+		if gotRetryAfter, _ := retryAfter(gotErr); gotRetryAfter != tt.wantRetryAfter {
+			t.Errorf("%v: An unexpected Retry-After delay was returned. Want '%v', Got '%v'", tt.name, tt.wantRetryAfter, gotRetryAfter)
+		}
+	}
+}
+
+func TestNewHTTPRetrieverInvalidTemplate(t *testing.T) {
+	t.Parallel()
+
+	// Test the results.
+	if _, gotErr := NewHTTPRetriever(http.MethodPost, "http://127.0.0.1:0", "token", WithHTTPBody("{{.Role", nil)); gotErr == nil {
+		t.Errorf("An unexpected error occurred. Want an error, Got '%v'", gotErr)
+	}
+}
@@ -0,0 +1,177 @@
+package backoff
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+)
+
+// Jitter selects how retry intervals are randomized during the backoff
+// phases.
+type Jitter int
+
+const (
+	// JitterDefault keeps the randomization built into the backoff strategy,
+	// i.e. +/-50% of each exponential interval and none for the constant one.
+	JitterDefault Jitter = iota
+
+	// JitterFull waits a random duration between zero and the interval.
+	JitterFull
+
+	// JitterEqual waits half the interval plus a random duration up to the
+	// other half.
+	JitterEqual
+
+	// JitterDecorrelated waits a random duration between the base interval
+	// and three times the previous wait, capped at the max interval. The
+	// exponential phase uses its initial and max intervals; the constant phase
+	// uses half the interval and the interval.
+	JitterDecorrelated
+)
+
+// WithRetryJitter sets the Jitter mode used by the backoff phases.
+func WithRetryJitter(jitter Jitter) Option {
+	return func(m *tokenRefresher) {
+		m.retryJitter = jitter
+	}
+}
+
+// WithRefreshJitter spreads timed refreshes so that instances which retrieved
+// their tokens at the same time don't keep refreshing together. Each refresh
+// is scheduled at a random point in the last fraction of the time until
+// expiresIn - refreshBuffer, e.g. 0.1 picks a point in the last 10%.
+func WithRefreshJitter(fraction float64) Option {
+	return func(m *tokenRefresher) {
+		m.refreshJitter = fraction
+	}
+}
+
+// WithRandSource sets the source of randomness used for jitter. It defaults to
+// a source seeded from the current time; tests can pass rand.NewSource(seed)
+// for reproducible schedules.
+func WithRandSource(src rand.Source) Option {
+	return func(m *tokenRefresher) {
+		m.rand = &lockedRand{rand: rand.New(src)}
+	}
+}
+
+// lockedRand is a rand.Rand that is safe for concurrent use, since backoff
+// tickers call NextBackOff from their own goroutines.
+type lockedRand struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// duration returns a random duration in [0, max).
+func (r *lockedRand) duration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Duration(r.rand.Int63n(int64(max)))
+}
+
+// random returns the refresher's source of randomness, creating a time seeded
+// one if none was configured.
+func (m *tokenRefresher) random() *lockedRand {
+	m.randOnce.Do(func() {
+		if m.rand == nil {
+			m.rand = &lockedRand{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+		}
+	})
+	return m.rand
+}
+
+// spread applies the refresh jitter to a scheduled refresh delay. Like
+// nextRefresh, it never returns less than minRefreshDelay.
+func (m *tokenRefresher) spread(d time.Duration) time.Duration {
+	if m.refreshJitter <= 0 || d <= 0 {
+		return d
+	}
+	fraction := m.refreshJitter
+	if fraction > 1 {
+		fraction = 1
+	}
+	d -= m.random().duration(time.Duration(float64(d) * fraction))
+	if d < minRefreshDelay {
+		d = minRefreshDelay
+	}
+	return d
+}
+
+// minRetryBudget is the shortest max elapsed time of the first phase of a
+// refresh. cenkalti/backoff never gives up if it is 0, so a budget that is
+// already spent must still be positive for the phase to end.
+const minRetryBudget = time.Nanosecond
+
+// exponentialBackOff returns the strategy for the first phase of a refresh,
+// which gives up after maxElapsed, or after the first attempt if maxElapsed
+// isn't positive.
+func (m *tokenRefresher) exponentialBackOff(maxElapsed time.Duration) backoff.BackOff {
+	if maxElapsed < minRetryBudget {
+		maxElapsed = minRetryBudget
+	}
+	eb := backoff.NewExponentialBackOff()
+	eb.MaxElapsedTime = maxElapsed
+	if m.retryJitter == JitterDefault {
+		return eb
+	}
+	eb.RandomizationFactor = 0
+	return &jitterBackOff{b: eb, mode: m.retryJitter, rand: m.random(), base: eb.InitialInterval, cap: eb.MaxInterval}
+}
+
+// constantBackOff returns the strategy for the second phase of a refresh,
+// which retries until it succeeds.
+func (m *tokenRefresher) constantBackOff(interval time.Duration) backoff.BackOff {
+	cb := backoff.NewConstantBackOff(interval)
+	if m.retryJitter == JitterDefault {
+		return cb
+	}
+	return &jitterBackOff{b: cb, mode: m.retryJitter, rand: m.random(), base: interval / 2, cap: interval}
+}
+
+// jitterBackOff randomizes the intervals of the wrapped strategy, which still
+// decides when to stop.
+type jitterBackOff struct {
+	b    backoff.BackOff
+	mode Jitter
+	rand *lockedRand
+
+	base time.Duration
+	cap  time.Duration
+	prev time.Duration
+}
+
+func (j *jitterBackOff) Reset() {
+	j.b.Reset()
+	j.prev = j.base
+}
+
+func (j *jitterBackOff) NextBackOff() time.Duration {
+	d := j.b.NextBackOff()
+	if d == backoff.Stop {
+		return d
+	}
+
+	switch j.mode {
+	case JitterFull:
+		return j.rand.duration(d + 1)
+	case JitterEqual:
+		return d/2 + j.rand.duration(d-d/2+1)
+	case JitterDecorrelated:
+		hi := 3 * j.prev
+		if hi < j.base {
+			hi = j.base
+		}
+		next := j.base + j.rand.duration(hi-j.base+1)
+		if next > j.cap {
+			next = j.cap
+		}
+		j.prev = next
+		return next
+	}
+	return d
+}
@@ -0,0 +1,167 @@
+package backoff
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/inconshreveable/log15"
+)
+
+func TestJitterBackOff(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	interval := time.Second
+	tests := []struct {
+		mode    Jitter
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{JitterFull, 0, interval},
+		{JitterEqual, interval / 2, interval},
+		{JitterDecorrelated, interval / 2, interval},
+	}
+
+	for _, tt := range tests {
+		// Define tokenRefresher service.
+		m := tokenRefresher{
+			logger:      log15.New("global", "backoff_test"),
+			retryJitter: tt.mode,
+		}
+		WithRandSource(rand.NewSource(1))(&m)
+
+		// Test the results.
+		b := m.constantBackOff(interval)
+		b.Reset()
+		for i := 0; i < 100; i++ {
+			got := b.NextBackOff()
+			if got < tt.wantMin || got > tt.wantMax {
+				t.Errorf("Jitter mode %v returned an interval out of range. Want '%v'-'%v', Got '%v'", tt.mode, tt.wantMin, tt.wantMax, got)
+			}
+		}
+	}
+}
+
+func TestJitterBackOffReproducible(t *testing.T) {
+	t.Parallel()
+
+	// Define tokenRefresher services.
+	newRefresher := func() *tokenRefresher {
+		m := tokenRefresher{
+			logger:        log15.New("global", "backoff_test"),
+			retryJitter:   JitterDecorrelated,
+			refreshJitter: 0.5,
+		}
+		WithRandSource(rand.NewSource(42))(&m)
+		return &m
+	}
+	m1, m2 := newRefresher(), newRefresher()
+
+	// Test the results.
+	b1, b2 := m1.exponentialBackOff(time.Minute), m2.exponentialBackOff(time.Minute)
+	b1.Reset()
+	b2.Reset()
+	for i := 0; i < 10; i++ {
+		got1, got2 := b1.NextBackOff(), b2.NextBackOff()
+		if got1 != got2 {
+			t.Errorf("The same seed produced different intervals. Want '%v', Got '%v'", got1, got2)
+		}
+		got1, got2 = m1.spread(time.Hour), m2.spread(time.Hour)
+		if got1 != got2 {
+			t.Errorf("The same seed produced different schedules. Want '%v', Got '%v'", got1, got2)
+		}
+	}
+}
+
+func TestJitterBackOffStop(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	want := backoff.Stop
+
+	// Define tokenRefresher service.
+	m := tokenRefresher{
+		logger:      log15.New("global", "backoff_test"),
+		retryJitter: JitterFull,
+	}
+
+	// Test the results.
+	b := m.exponentialBackOff(-time.Second) // A negative max elapsed time stops after the first tick.
+	b.Reset()
+	if got := b.NextBackOff(); got != want {
+		t.Errorf("The wrapped strategy did not stop. Want '%v', Got '%v'", want, got)
+	}
+}
+
+func TestExponentialBackOffSpentBudget(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	want := backoff.Stop
+
+	// Define tokenRefresher service.
+	m := tokenRefresher{
+		logger:        log15.New("global", "backoff_test"),
+		refreshBuffer: time.Minute,
+	}
+	// A 2s token is refreshed at half-life, leaving a budget of 1s-1s.
+	m.nextRefresh(2 * time.Second)
+
+	// Test the results.
+	b := m.exponentialBackOff(m.currentBuffer() - time.Second)
+	b.Reset()
+	time.Sleep(time.Millisecond)
+	if got := b.NextBackOff(); got != want {
+		t.Errorf("The strategy did not stop with its budget spent. Want '%v', Got '%v'", want, got)
+	}
+}
+
+func TestSpread(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	scheduled := time.Hour
+	wantMin := 54 * time.Minute
+	wantMax := scheduled
+
+	// Define tokenRefresher service.
+	m := tokenRefresher{
+		logger:        log15.New("global", "backoff_test"),
+		refreshJitter: 0.1,
+	}
+
+	// Test the results.
+	for i := 0; i < 100; i++ {
+		got := m.spread(scheduled)
+		if got < wantMin || got > wantMax {
+			t.Errorf("The refresh was scheduled out of range. Want '%v'-'%v', Got '%v'", wantMin, wantMax, got)
+		}
+	}
+	m.refreshJitter = 0
+	if got := m.spread(scheduled); got != scheduled {
+		t.Errorf("The refresh was jittered without a jitter fraction. Want '%v', Got '%v'", scheduled, got)
+	}
+}
+
+func TestSpreadMinRefreshDelay(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	scheduled := minRefreshDelay
+	want := minRefreshDelay
+
+	// Define tokenRefresher service.
+	m := tokenRefresher{
+		logger:        log15.New("global", "backoff_test"),
+		refreshJitter: 1,
+	}
+
+	// Test the results.
+	for i := 0; i < 100; i++ {
+		if got := m.spread(scheduled); got != want {
+			t.Errorf("The refresh was scheduled sooner than the minimum delay. Want '%v', Got '%v'", want, got)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package backoff
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ParsePrivateKeyPEM parses an RSA, ECDSA or Ed25519 private key from the
+// first PEM block in data, in PKCS #8, PKCS #1 or SEC 1 form.
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("jwt: no PEM block found")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("jwt: parsing %s failed: %w", block.Type, err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("jwt: unsupported key type %T", key)
+	}
+	if _, err := jwtAlgorithm(signer); err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+// jwtAlgorithm returns the JWS algorithm used to sign with key.
+func jwtAlgorithm(key crypto.Signer) (string, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return "RS256", nil
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return "ES256", nil
+		case elliptic.P384():
+			return "ES384", nil
+		case elliptic.P521():
+			return "ES512", nil
+		}
+		return "", fmt.Errorf("jwt: unsupported curve %s", k.Curve.Params().Name)
+	case ed25519.PrivateKey:
+		return "EdDSA", nil
+	}
+	return "", fmt.Errorf("jwt: unsupported key type %T", key)
+}
+
+// signJWT returns a compact JWS of claims signed with key. keyID is set as the
+// kid header if it isn't empty.
+func signJWT(key crypto.Signer, keyID string, claims map[string]interface{}) (string, error) {
+	alg, err := jwtAlgorithm(key)
+	if err != nil {
+		return "", err
+	}
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if keyID != "" {
+		header["kid"] = keyID
+	}
+
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("jwt: encoding claims failed: %w", err)
+	}
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+
+	sig, err := jwtSign(key, alg, []byte(input))
+	if err != nil {
+		return "", fmt.Errorf("jwt: signing failed: %w", err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// jwtSign signs input as alg requires. ECDSA signatures are the fixed size
+// concatenation of r and s rather than ASN.1.
+func jwtSign(key crypto.Signer, alg string, input []byte) ([]byte, error) {
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		return k.Sign(rand.Reader, input, crypto.Hash(0))
+	case *ecdsa.PrivateKey:
+		hash := map[string]crypto.Hash{"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512}[alg]
+		hasher := hash.New()
+		hasher.Write(input)
+		r, s, err := ecdsa.Sign(rand.Reader, k, hasher.Sum(nil))
+		if err != nil {
+			return nil, err
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		sig := make([]byte, 2*size)
+		r.FillBytes(sig[:size])
+		s.FillBytes(sig[size:])
+		return sig, nil
+	}
+	hasher := crypto.SHA256.New()
+	hasher.Write(input)
+	return key.Sign(rand.Reader, hasher.Sum(nil), crypto.SHA256)
+}
+
+// jwtID returns a random JWT ID, so that a JWT can't be replayed.
+func jwtID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// parseJWTClaims decodes the claims of a compact JWS without verifying its
+// signature.
+func parseJWTClaims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("jwt: token is not a compact JWS")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("jwt: decoding claims failed: %w", err)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("jwt: decoding claims failed: %w", err)
+	}
+	return claims, nil
+}
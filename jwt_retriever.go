@@ -0,0 +1,116 @@
+package backoff
+
+import (
+	"crypto"
+	"time"
+)
+
+// JWTOption configures optional claims of a JWTRetriever.
+type JWTOption func(*JWTRetriever)
+
+// WithJWTIssuer sets the iss claim.
+func WithJWTIssuer(issuer string) JWTOption {
+	return func(r *JWTRetriever) {
+		r.issuer = issuer
+	}
+}
+
+// WithJWTSubject sets the sub claim.
+func WithJWTSubject(subject string) JWTOption {
+	return func(r *JWTRetriever) {
+		r.subject = subject
+	}
+}
+
+// WithJWTAudience sets the aud claim. A single audience is encoded as a string,
+// several as an array.
+func WithJWTAudience(audience ...string) JWTOption {
+	return func(r *JWTRetriever) {
+		r.audience = audience
+	}
+}
+
+// WithJWTClaims sets extra claims. They can't override the registered claims set
+// by the retriever.
+func WithJWTClaims(claims map[string]interface{}) JWTOption {
+	return func(r *JWTRetriever) {
+		r.claims = claims
+	}
+}
+
+// WithJWTKeyID sets the kid header.
+func WithJWTKeyID(keyID string) JWTOption {
+	return func(r *JWTRetriever) {
+		r.keyID = keyID
+	}
+}
+
+// JWTRetriever mints self-signed JWTs locally, for services that accept them
+// directly rather than tokens from a token endpoint. It needs no network,
+// which also makes it useful offline and in tests.
+//
+// Each JWT has iat, exp and a unique jti claim, and is valid for the
+// configured lifetime, which RetrieveToken returns as expiresIn so that the
+// refresher mints a new one before it expires.
+type JWTRetriever struct {
+	key      crypto.Signer
+	lifetime time.Duration
+
+	keyID    string
+	issuer   string
+	subject  string
+	audience []string
+	claims   map[string]interface{}
+}
+
+// NewJWTRetriever creates a JWTRetriever that signs JWTs valid for lifetime
+// with key, which must be an RSA, ECDSA or Ed25519 key.
+func NewJWTRetriever(key crypto.Signer, lifetime time.Duration, opts ...JWTOption) (*JWTRetriever, error) {
+	if _, err := jwtAlgorithm(key); err != nil {
+		return nil, err
+	}
+	r := JWTRetriever{
+		key:      key,
+		lifetime: lifetime,
+	}
+	for _, opt := range opts {
+		opt(&r)
+	}
+	return &r, nil
+}
+
+// RetrieveToken implements TokenRetriever.
+func (r *JWTRetriever) RetrieveToken() (token string, expiresIn time.Duration, err error) {
+	jti, err := jwtID()
+	if err != nil {
+		return "", 0, err
+	}
+
+	claims := make(map[string]interface{}, len(r.claims)+6)
+	for k, v := range r.claims {
+		claims[k] = v
+	}
+	if r.issuer != "" {
+		claims["iss"] = r.issuer
+	}
+	if r.subject != "" {
+		claims["sub"] = r.subject
+	}
+	switch len(r.audience) {
+	case 0:
+	case 1:
+		claims["aud"] = r.audience[0]
+	default:
+		claims["aud"] = r.audience
+	}
+	now := time.Now()
+	claims["jti"] = jti
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(r.lifetime).Unix()
+
+	token, err = signJWT(r.key, r.keyID, claims)
+	if err != nil {
+		return "", 0, Permanent(err)
+	}
+	return token, r.lifetime, nil
+}
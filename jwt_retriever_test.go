@@ -0,0 +1,85 @@
+package backoff
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+)
+
+func TestJWTRetriever(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantExpiresIn := 10 * time.Minute
+	wantClaims := map[string]interface{}{
+		"iss":  "service1",
+		"sub":  "service1@example.com",
+		"aud":  "api",
+		"role": "reader",
+	}
+
+	// Define JWTRetriever.
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewJWTRetriever(key, wantExpiresIn,
+		WithJWTIssuer("service1"),
+		WithJWTSubject("service1@example.com"),
+		WithJWTAudience("api"),
+		WithJWTClaims(map[string]interface{}{"role": "reader", "exp": 0}),
+		WithJWTKeyID("key1"),
+	)
+	if err != nil {
+		t.Fatalf("An unexpected error occurred. Want '%v', Got '%v'", nil, err)
+	}
+
+	// Test the results.
+	gotToken, gotExpiresIn, gotErr := r.RetrieveToken()
+	if gotErr != nil {
+		t.Fatalf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+	}
+	if gotExpiresIn != wantExpiresIn {
+		t.Errorf("An unexpected expiry was returned. Want '%v', Got '%v'", wantExpiresIn, gotExpiresIn)
+	}
+
+	header, claims := verifyJWT(t, gotToken, key)
+	if header["kid"] != "key1" {
+		t.Errorf("An unexpected key ID was returned. Want '%v', Got '%v'", "key1", header["kid"])
+	}
+	for k, want := range wantClaims {
+		if claims[k] != want {
+			t.Errorf("An unexpected %v claim was returned. Want '%v', Got '%v'", k, want, claims[k])
+		}
+	}
+	iat, _ := claims["iat"].(float64)
+	exp, _ := claims["exp"].(float64)
+	if gotLifetime := time.Duration(exp-iat) * time.Second; gotLifetime != wantExpiresIn {
+		t.Errorf("The JWT has an unexpected lifetime. Want '%v', Got '%v'", wantExpiresIn, gotLifetime)
+	}
+
+	nextToken, _, _ := r.RetrieveToken()
+	_, nextClaims := verifyJWT(t, nextToken, key)
+	if nextClaims["jti"] == claims["jti"] {
+		t.Errorf("The JWT ID was reused. Got '%v'", claims["jti"])
+	}
+}
+
+func TestJWTRetrieverAudiences(t *testing.T) {
+	t.Parallel()
+
+	// Define JWTRetriever.
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := NewJWTRetriever(key, time.Minute, WithJWTAudience("api1", "api2"))
+
+	// Test the results.
+	gotToken, _, _ := r.RetrieveToken()
+	_, claims := verifyJWT(t, gotToken, key)
+	if aud, ok := claims["aud"].([]interface{}); !ok || len(aud) != 2 || aud[0] != "api1" || aud[1] != "api2" {
+		t.Errorf("An unexpected audience was returned. Want '%v', Got '%v'", []string{"api1", "api2"}, claims["aud"])
+	}
+}
@@ -0,0 +1,154 @@
+package backoff
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// verifyJWT checks the signature of token against the public key of key, and
+// returns its header and claims.
+func verifyJWT(t *testing.T, token string, key crypto.Signer) (header, claims map[string]interface{}) {
+	t.Helper()
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("The JWT is malformed. Want '%v' parts, Got '%v'", 3, len(parts))
+	}
+	for i, v := range []*map[string]interface{}{&header, &claims} {
+		b, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil {
+			t.Fatalf("The JWT is malformed: %v", err)
+		}
+		if err := json.Unmarshal(b, v); err != nil {
+			t.Fatalf("The JWT is malformed: %v", err)
+		}
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("The JWT is malformed: %v", err)
+	}
+
+	input := []byte(parts[0] + "." + parts[1])
+	valid := false
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		sum := sha256.Sum256(input)
+		valid = rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig) == nil
+	case *ecdsa.PublicKey:
+		size := len(sig) / 2
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		switch header["alg"] {
+		case "ES256":
+			sum := sha256.Sum256(input)
+			valid = ecdsa.Verify(pub, sum[:], r, s)
+		case "ES384":
+			sum := sha512.Sum384(input)
+			valid = ecdsa.Verify(pub, sum[:], r, s)
+		}
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(pub, input, sig)
+	}
+	if !valid {
+		t.Errorf("The JWT signature is invalid")
+	}
+	return header, claims
+}
+
+// testKeys returns PEM encoded keys of every supported type, along with the
+// algorithm each should be signed with.
+func testKeys(t *testing.T) []struct {
+	pem     []byte
+	wantAlg string
+} {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkcs8 := func(key interface{}) []byte {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+	sec1, err := x509.MarshalECPrivateKey(p256Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return []struct {
+		pem     []byte
+		wantAlg string
+	}{
+		{pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), "RS256"},
+		{pkcs8(rsaKey), "RS256"},
+		{pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}), "ES256"},
+		{pkcs8(p384Key), "ES384"},
+		{pkcs8(edKey), "EdDSA"},
+	}
+}
+
+func TestSignJWT(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range testKeys(t) {
+		// Define expectations.
+		wantSub := "client1"
+
+		// Define key.
+		key, err := ParsePrivateKeyPEM(tt.pem)
+		if err != nil {
+			t.Fatalf("An unexpected error occurred. Want '%v', Got '%v'", nil, err)
+		}
+
+		// Test the results.
+		token, err := signJWT(key, "key1", map[string]interface{}{"sub": wantSub})
+		if err != nil {
+			t.Fatalf("An unexpected error occurred. Want '%v', Got '%v'", nil, err)
+		}
+		header, claims := verifyJWT(t, token, key)
+		if header["alg"] != tt.wantAlg || header["kid"] != "key1" {
+			t.Errorf("An unexpected header was returned. Want '%v' '%v', Got '%v' '%v'", tt.wantAlg, "key1", header["alg"], header["kid"])
+		}
+		if claims["sub"] != wantSub {
+			t.Errorf("An unexpected subject was returned. Want '%v', Got '%v'", wantSub, claims["sub"])
+		}
+	}
+}
+
+func TestParsePrivateKeyPEMInvalid(t *testing.T) {
+	t.Parallel()
+
+	// Test the results.
+	if _, gotErr := ParsePrivateKeyPEM([]byte("not a key")); gotErr == nil {
+		t.Errorf("An unexpected error occurred. Want an error, Got '%v'", gotErr)
+	}
+}
@@ -0,0 +1,201 @@
+package backoff
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/inconshreveable/log15"
+)
+
+// NewLazyTokenRefresher creates a tokenRefresher that doesn't run a goroutine
+// of its own. Nothing is retrieved until the first call to GetToken, and later
+// refreshes happen on the goroutine calling GetToken once the token is within
+// its refresh buffer of expiry. This suits short-lived programs and rarely
+// used credentials.
+//
+// Concurrent callers share a single refresh. While the stored token is still
+// valid, only one caller retrieves a new one and the others are served the
+// old token; a failed attempt is retried by a later call once the usual
+// backoff interval has passed. When there is no valid token, callers wait for
+// a refresh that retries with exponential backoff for up to the refresh
+// buffer, and get the last error if it doesn't succeed.
+//
+// Refresh makes the next call to GetToken retrieve a new token before
+// returning, and clears a permanent error so that retrieval is attempted
+// again.
+func NewLazyTokenRefresher(logger log15.Logger, refreshBuffer time.Duration, retriever TokenRetriever, opts ...Option) TokenRefresher {
+	m := NewRunnableTokenRefresher(logger, refreshBuffer, retriever, opts...).(*tokenRefresher)
+	m.started.Store(true) // There is nothing to run.
+	m.onDemand = &onDemand{}
+	m.attach()
+	return m
+}
+
+// onDemand is the state of a lazy tokenRefresher.
+type onDemand struct {
+	mu       sync.Mutex
+	flight   chan struct{} // Closed when the refresh in flight has finished.
+	halted   bool          // A permanent error stopped refreshes until Refresh is called.
+	forced   bool          // Refresh was called.
+	rederive bool          // The parent rotated its token.
+
+	retries backoff.BackOff // Paces attempts to replace a token that is still valid.
+	next    time.Time
+}
+
+// refreshOnDemand refreshes the token on the calling goroutine if it is due,
+// or waits for a refresh in flight if the stored token can't be used.
+func (m *tokenRefresher) refreshOnDemand() {
+	s := m.load()
+	if m.serveStale && s.token != "" && !s.stale && time.Now().After(s.expiry) {
+		m.markStale()
+	}
+
+	o := m.onDemand
+	o.mu.Lock()
+	// Checked under the lock, so that CloseContext can exclude new refreshes.
+	select {
+	case <-m.done:
+		o.mu.Unlock()
+		return
+	default:
+	}
+	s = m.load()
+	now := time.Now()
+	usable := s.token != "" && (now.Before(s.expiry) || m.serveStale && now.Before(s.expiry.Add(m.staleGrace)))
+	due := !usable || o.forced || o.rederive || s.expiry.Sub(now) <= m.currentBuffer()
+	if !due || o.halted && !o.forced || usable && !o.forced && now.Before(o.next) {
+		o.mu.Unlock()
+		return
+	}
+	if f := o.flight; f != nil {
+		o.mu.Unlock()
+		if !usable {
+			<-f
+		}
+		return
+	}
+
+	f := make(chan struct{})
+	o.flight = f
+	forced, rederive := o.forced, o.rederive
+	o.forced, o.rederive, o.halted = false, false, false
+	buffer := m.currentBuffer()
+	m.running.Add(1)
+	o.mu.Unlock()
+	defer func() {
+		o.mu.Lock()
+		o.flight = nil
+		o.mu.Unlock()
+		close(f)
+		m.running.Done()
+	}()
+
+	switch {
+	case forced:
+		m.logger.Info("Forced refresh", "reason", m.forced())
+		m.mu.Lock()
+		m.revoke()
+		m.mu.Unlock()
+		m.refreshBlocking(buffer)
+	case usable && rederive:
+		m.setReason("parent rotated")
+		m.refreshOnce(s.expiry)
+	case usable:
+		m.setReason("scheduled")
+		m.refreshOnce(s.expiry)
+	default:
+		m.setReason("on demand")
+		m.refreshBlocking(buffer)
+	}
+}
+
+// refreshBlocking retrieves a token while readers wait, retrying with an
+// exponential backoff for up to buffer. If every attempt fails, the last
+// error is stored for the waiting readers.
+func (m *tokenRefresher) refreshBlocking(buffer time.Duration) {
+	m.lock()
+	defer m.unlock()
+
+	token, expiresIn, err := m.refreshInner(m.exponentialBackOff(buffer-time.Second), m.done)
+	switch {
+	case err == nil:
+		m.refreshedOnDemand(token, expiresIn)
+	case err == ErrShutdown:
+	case m.isPermanent(err):
+		m.fail(err)
+		m.halt()
+	default:
+		m.expire()
+		m.update(func(s *tokenState) {
+			s.err = err
+		})
+		m.logger.Crit("Could not retrieve token on demand", "err", err)
+	}
+}
+
+// refreshOnce makes a single attempt to replace a token that is still valid
+// until expiry. If it fails, the next attempt is delayed by the exponential
+// backoff until expiry, then by the constant backoff, or by the Retry-After
+// delay of the error if that is longer.
+func (m *tokenRefresher) refreshOnce(expiry time.Time) {
+	token, expiresIn, err := m.retrieve(m.done)
+	if err == nil {
+		m.mu.Lock()
+		defer m.mu.Unlock() // Hooks may panic.
+		m.refreshedOnDemand(token, expiresIn)
+		return
+	}
+	if err == ErrShutdown {
+		return
+	}
+	if m.isPermanent(err) {
+		defer m.halt()
+		m.lock()
+		defer m.unlock()
+		m.fail(err)
+		return
+	}
+	m.onError(err, false)
+	m.logger.Error("Failed to refresh token. Retrying on demand...", "err", err)
+
+	o := m.onDemand
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.retries == nil {
+		o.retries = m.exponentialBackOff(time.Until(expiry) - time.Second)
+		o.retries.Reset()
+	}
+	d := o.retries.NextBackOff()
+	if d == backoff.Stop {
+		o.retries = m.constantBackOff(1 * time.Minute)
+		o.retries.Reset()
+		d = o.retries.NextBackOff()
+	}
+	if ra, ok := retryAfter(err); ok && ra > d {
+		d = ra
+	}
+	o.next = time.Now().Add(d)
+}
+
+// refreshedOnDemand stores a retrieved token and resets the backoff. It must
+// be called with the lock held.
+func (m *tokenRefresher) refreshedOnDemand(token Token, expiresIn time.Duration) {
+	m.setToken(token, expiresIn)
+	m.onRefresh(token.Value, expiresIn)
+
+	o := m.onDemand
+	o.mu.Lock()
+	m.nextRefresh(expiresIn) // Records the refresh buffer of the new token.
+	o.retries = nil
+	o.next = time.Time{}
+	o.mu.Unlock()
+}
+
+// halt stops refreshes until Refresh is called, after a permanent error.
+func (m *tokenRefresher) halt() {
+	m.onDemand.mu.Lock()
+	m.onDemand.halted = true
+	m.onDemand.mu.Unlock()
+}
@@ -0,0 +1,285 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+func TestLazyTokenRefresher(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "cachedToken01"
+	wantCalled := 1
+
+	// Define tokenRefresher service.
+	retriever := mockRetriever{
+		token:          "cachedToken",
+		incrementToken: true,
+		expiresIn:      time.Hour,
+	}
+	m := NewLazyTokenRefresher(log15.New("global", "backoff_test"), time.Minute, &retriever)
+	defer m.Close()
+
+	// Test the results.
+	time.Sleep(50 * time.Millisecond)
+	if retriever.called != 0 {
+		t.Errorf("The retriever was called before GetToken. Want '%v', Got '%v'", 0, retriever.called)
+	}
+
+	for i := 0; i < 3; i++ {
+		gotToken, gotErr := m.GetToken()
+		if gotErr != nil {
+			t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+		}
+		if gotToken != wantToken {
+			t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken)
+		}
+	}
+	if retriever.called != wantCalled {
+		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalled, retriever.called)
+	}
+}
+
+func TestLazyTokenRefresherWithinBuffer(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "cachedToken02"
+	wantCalled := 2
+
+	// Define tokenRefresher service.
+	retriever := mockRetriever{
+		token:          "cachedToken",
+		incrementToken: true,
+		expiresIn:      1500 * time.Millisecond,
+	}
+	m := NewLazyTokenRefresher(log15.New("global", "backoff_test"), time.Second, &retriever)
+	defer m.Close()
+
+	// Test the results.
+	m.GetToken()
+	time.Sleep(600 * time.Millisecond) // The token is now within the refresh buffer.
+
+	gotToken, gotErr := m.GetToken()
+	if gotErr != nil {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+	}
+	if gotToken != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken)
+	}
+	if retriever.called != wantCalled {
+		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalled, retriever.called)
+	}
+}
+
+func TestLazyTokenRefresherServesValidTokenOnFailure(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "cachedToken01"
+	wantCalled := 2
+
+	// Define tokenRefresher service.
+	retriever := mockRetriever{
+		token:          "cachedToken",
+		incrementToken: true,
+		expiresIn:      1500 * time.Millisecond,
+	}
+	m := NewLazyTokenRefresher(log15.New("global", "backoff_test"), time.Second, &retriever)
+	defer m.Close()
+
+	// Test the results.
+	m.GetToken()
+	time.Sleep(600 * time.Millisecond)
+	retriever.numFails = 1
+
+	for i := 0; i < 3; i++ {
+		gotToken, gotErr := m.GetToken() // Only the first call attempts; the others are backing off.
+		if gotErr != nil {
+			t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+		}
+		if gotToken != wantToken {
+			t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken)
+		}
+	}
+	if retriever.called != wantCalled {
+		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalled, retriever.called)
+	}
+	if m.Status().LastError == nil {
+		t.Errorf("The failed attempt was not recorded")
+	}
+}
+
+func TestLazyTokenRefresherCoalesces(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "cachedToken123"
+	wantCalled := int32(1)
+	callers := 10
+
+	// Define tokenRefresher service.
+	var called int32
+	retriever := RetrieverFunc(func(ctx context.Context) (Token, error) {
+		atomic.AddInt32(&called, 1)
+		time.Sleep(50 * time.Millisecond)
+		return Token{Value: wantToken, Expiry: time.Now().Add(time.Hour)}, nil
+	})
+	m := NewLazyTokenRefresher(log15.New("global", "backoff_test"), time.Minute, retriever)
+	defer m.Close()
+
+	// Test the results.
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gotToken, gotErr := m.GetToken()
+			if gotErr != nil || gotToken != wantToken {
+				t.Errorf("An unexpected token was returned. Want '%v', Got '%v' '%v'", wantToken, gotToken, gotErr)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if gotCalled := atomic.LoadInt32(&called); gotCalled != wantCalled {
+		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalled, gotCalled)
+	}
+}
+
+func TestLazyTokenRefresherPermanentError(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantErr := errors.New("invalid_client")
+	wantToken := "cachedToken123"
+
+	// Define tokenRefresher service.
+	retriever := mockRetriever{
+		permanentFail: true,
+		err:           Permanent(wantErr),
+		token:         wantToken,
+		expiresIn:     time.Hour,
+	}
+	m := NewLazyTokenRefresher(log15.New("global", "backoff_test"), time.Minute, &retriever)
+	defer m.Close()
+
+	// Test the results.
+	for i := 0; i < 2; i++ {
+		_, gotErr := m.GetToken() // The second call doesn't retry.
+		if !errors.Is(gotErr, wantErr) {
+			t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+		}
+	}
+	if retriever.called != 1 {
+		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", 1, retriever.called)
+	}
+
+	retriever.permanentFail = false
+	m.Refresh("credentials fixed")
+	gotToken, gotErr := m.GetToken()
+	if gotErr != nil {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+	}
+	if gotToken != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken)
+	}
+	if gotReason := m.Status().Reason; gotReason != "credentials fixed" {
+		t.Errorf("An unexpected reason was recorded. Want '%v', Got '%v'", "credentials fixed", gotReason)
+	}
+}
+
+func TestLazyTokenRefresherCloseContext(t *testing.T) {
+	t.Parallel()
+
+	// Define tokenRefresher service.
+	var closed, calledAfterClose atomic.Bool
+	retriever := RetrieverFunc(func(ctx context.Context) (Token, error) {
+		if closed.Load() {
+			calledAfterClose.Store(true)
+		}
+		return Token{Value: "cachedToken123", Expiry: time.Now().Add(time.Hour)}, nil
+	})
+	m := NewLazyTokenRefresher(log15.New("global", "backoff_test"), time.Minute, retriever).(*tokenRefresher)
+	m.setToken(Token{Value: "cachedToken123"}, 30*time.Second) // Within the refresh buffer, so GetToken refreshes without waiting.
+
+	// Test the results.
+	m.onDemand.mu.Lock() // Holds GetToken between checking for shutdown and starting the refresh.
+	got := make(chan struct{})
+	go func() {
+		defer close(got)
+		m.GetToken()
+	}()
+	time.Sleep(20 * time.Millisecond)
+	stopped := make(chan error, 1)
+	go func() {
+		err := m.CloseContext(context.Background())
+		closed.Store(true)
+		stopped <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	m.onDemand.mu.Unlock()
+
+	if gotErr := <-stopped; gotErr != nil {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+	}
+	<-got
+	if calledAfterClose.Load() {
+		t.Errorf("The retriever was called after CloseContext returned")
+	}
+}
+
+func TestLazyTokenRefresherHookPanic(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "newToken123"
+
+	// Define tokenRefresher service.
+	retriever := mockRetriever{
+		token:     wantToken,
+		expiresIn: time.Hour,
+	}
+	var panicked atomic.Bool
+	m := NewLazyTokenRefresher(log15.New("global", "backoff_test"), time.Minute, &retriever, WithHooks(Hooks{
+		OnRefresh: func(token string, expiresIn time.Duration) {
+			if panicked.CompareAndSwap(false, true) {
+				panic("hook panic")
+			}
+		},
+	})).(*tokenRefresher)
+	defer m.Close()
+	m.setToken(Token{Value: "cachedToken123"}, 30*time.Second) // Within the refresh buffer, so GetToken refreshes without waiting.
+
+	// Test the results.
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Errorf("The hook did not panic. Want '%v', Got '%v'", "hook panic", r)
+			}
+		}()
+		m.GetToken()
+	}()
+
+	m.Refresh("test")
+	got := make(chan string, 1)
+	go func() {
+		gotToken, _ := m.GetToken()
+		got <- gotToken
+	}()
+	select {
+	case gotToken := <-got:
+		if gotToken != wantToken {
+			t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("GetToken deadlocked after a hook panic")
+	}
+}
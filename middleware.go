@@ -0,0 +1,250 @@
+package backoff
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// Middleware wraps a TokenRetriever with a cross-cutting concern, so that
+// retriever implementations can stay focused on their protocol.
+type Middleware func(TokenRetriever) TokenRetriever
+
+// Chain wraps r with middleware. The first middleware is the outermost, so
+// Chain(r, LoggingMiddleware(l), TimeoutMiddleware(d)) logs calls including
+// any that time out.
+func Chain(r TokenRetriever, middleware ...Middleware) TokenRetriever {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		r = middleware[i](r)
+	}
+	return r
+}
+
+// RetrieverFunc adapts a function to a ContextRetriever.
+type RetrieverFunc func(ctx context.Context) (Token, error)
+
+// RetrieveToken implements TokenRetriever.
+func (f RetrieverFunc) RetrieveToken() (token string, expiresIn time.Duration, err error) {
+	t, expiresIn, err := retrieveContext(context.Background(), f)
+	return t.Value, expiresIn, err
+}
+
+// RetrieveTokenContext implements ContextRetriever.
+func (f RetrieverFunc) RetrieveTokenContext(ctx context.Context) (Token, error) {
+	return f(ctx)
+}
+
+// TimeoutMiddleware limits each call to timeout. Context aware retrievers
+// have their context cancelled; other calls are abandoned and their results
+// discarded.
+func TimeoutMiddleware(timeout time.Duration) Middleware {
+	return func(next TokenRetriever) TokenRetriever {
+		return RetrieverFunc(func(ctx context.Context) (Token, error) {
+			return retrieveTimeout(ctx, next, timeout)
+		})
+	}
+}
+
+// retrieveTimeout calls r, giving up after timeout.
+func retrieveTimeout(ctx context.Context, r TokenRetriever, timeout time.Duration) (Token, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		token Token
+		err   error
+	}
+	results := make(chan result, 1)
+	go func() {
+		token, _, err := retrieveContext(ctx, r)
+		results <- result{token: token, err: err}
+	}()
+
+	select {
+	case res := <-results:
+		return res.token, res.err
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return Token{}, fmt.Errorf("token retrieval timed out after %v: %w", timeout, ctx.Err())
+		}
+		return Token{}, ctx.Err()
+	}
+}
+
+// LoggingMiddleware logs every call with its duration and outcome. Tokens are
+// never logged; a short fingerprint is logged instead so that rotations can be
+// followed.
+func LoggingMiddleware(logger log15.Logger) Middleware {
+	return func(next TokenRetriever) TokenRetriever {
+		return RetrieverFunc(func(ctx context.Context) (Token, error) {
+			start := time.Now()
+			token, expiresIn, err := retrieveContext(ctx, next)
+			if err != nil {
+				logger.Warn("Token retrieval failed", "duration", time.Since(start), "permanent", IsPermanent(err), "err", err)
+				return Token{}, err
+			}
+			logger.Debug("Token retrieved", "duration", time.Since(start), "fingerprint", fingerprint(token.Value), "expiresIn", expiresIn, "source", token.Source)
+			return token, nil
+		})
+	}
+}
+
+// fingerprint identifies a token without revealing it.
+func fingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:4])
+}
+
+// RetrieverMetrics receives a measurement of every retriever call.
+type RetrieverMetrics interface {
+	ObserveRetrieval(duration time.Duration, err error)
+}
+
+// MetricsMiddleware reports the duration and outcome of every call to metrics.
+func MetricsMiddleware(metrics RetrieverMetrics) Middleware {
+	return func(next TokenRetriever) TokenRetriever {
+		return RetrieverFunc(func(ctx context.Context) (Token, error) {
+			start := time.Now()
+			token, _, err := retrieveContext(ctx, next)
+			metrics.ObserveRetrieval(time.Since(start), err)
+			return token, err
+		})
+	}
+}
+
+// RateLimitMiddleware limits calls to one per interval on average, allowing
+// bursts of up to burst calls. Calls over the limit wait for their turn, or
+// fail if their context is cancelled first.
+func RateLimitMiddleware(interval time.Duration, burst int) Middleware {
+	if burst < 1 {
+		burst = 1
+	}
+	return func(next TokenRetriever) TokenRetriever {
+		l := &rateLimiter{interval: interval, burst: float64(burst), tokens: float64(burst)}
+		return RetrieverFunc(func(ctx context.Context) (Token, error) {
+			if err := l.wait(ctx); err != nil {
+				return Token{}, err
+			}
+			token, _, err := retrieveContext(ctx, next)
+			return token, err
+		})
+	}
+}
+
+// rateLimiter is a token bucket refilled at one token per interval.
+type rateLimiter struct {
+	interval time.Duration
+	burst    float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// wait blocks until a call is allowed.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	d := l.reserve()
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token from the bucket, returning how long to wait until the
+// token is actually available.
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if !l.last.IsZero() && l.interval > 0 {
+		l.tokens += float64(now.Sub(l.last)) / float64(l.interval)
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens * float64(l.interval))
+}
+
+// cancel returns a reserved token that wasn't used.
+func (l *rateLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens++
+}
+
+// ConcurrencyLimitMiddleware limits the number of calls in flight at once to
+// limit, which is at least 1. Calls over the limit wait for a slot, or fail if
+// their context is cancelled first.
+func ConcurrencyLimitMiddleware(limit int) Middleware {
+	if limit < 1 {
+		limit = 1
+	}
+	return func(next TokenRetriever) TokenRetriever {
+		slots := make(chan struct{}, limit)
+		return RetrieverFunc(func(ctx context.Context) (Token, error) {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return Token{}, ctx.Err()
+			}
+			defer func() { <-slots }()
+
+			token, _, err := retrieveContext(ctx, next)
+			return token, err
+		})
+	}
+}
+
+// JWTExpiryMiddleware derives the expiry of JWT tokens from their exp claim,
+// for token endpoints that omit or misreport the lifetime of the JWTs they
+// return. The expiry is the earlier of the reported expiry and exp; a
+// reported expiry that has already passed, as when the lifetime was omitted,
+// is ignored. The decoded claims are returned as the token's Claims.
+//
+// The JWT signature is not verified, so the claims must only be used to
+// manage the token, not to make authorization decisions. Tokens that aren't
+// JWTs are returned unchanged.
+func JWTExpiryMiddleware() Middleware {
+	return func(next TokenRetriever) TokenRetriever {
+		return RetrieverFunc(func(ctx context.Context) (Token, error) {
+			token, _, err := retrieveContext(ctx, next)
+			if err != nil {
+				return Token{}, err
+			}
+
+			claims, err := parseJWTClaims(token.Value)
+			if err != nil {
+				return token, nil
+			}
+			token.Claims = claims
+			if exp, ok := claims["exp"].(float64); ok {
+				claimed := time.Unix(int64(exp), 0)
+				if !token.Expiry.After(time.Now()) || claimed.Before(token.Expiry) {
+					token.Expiry = claimed
+				}
+			}
+			return token, nil
+		})
+	}
+}
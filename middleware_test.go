@@ -0,0 +1,295 @@
+package backoff
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// countingMetrics records the retriever calls it observes.
+type countingMetrics struct {
+	mu     sync.Mutex
+	calls  int
+	errors int
+}
+
+func (c *countingMetrics) ObserveRetrieval(duration time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	if err != nil {
+		c.errors++
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	want := "outer>inner>retriever"
+
+	// Define middleware.
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next TokenRetriever) TokenRetriever {
+			return RetrieverFunc(func(ctx context.Context) (Token, error) {
+				calls = append(calls, name)
+				token, _, err := retrieveContext(ctx, next)
+				return token, err
+			})
+		}
+	}
+	r := Chain(RetrieverFunc(func(ctx context.Context) (Token, error) {
+		calls = append(calls, "retriever")
+		return Token{Value: "newToken123", Expiry: time.Now().Add(time.Hour)}, nil
+	}), record("outer"), record("inner"))
+
+	// Test the results.
+	if _, _, gotErr := r.RetrieveToken(); gotErr != nil {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+	}
+	if got := strings.Join(calls, ">"); got != want {
+		t.Errorf("The middleware was called in an unexpected order. Want '%v', Got '%v'", want, got)
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantErr := context.DeadlineExceeded
+	maxDelay := 500 * time.Millisecond
+
+	// Define retrievers.
+	aware := slowRetriever{token: "newToken123", delay: time.Minute, cancelled: make(chan struct{})}
+	block := make(chan struct{})
+	defer close(block)
+	blocking := &blockingRetriever{block: block}
+
+	// Test the results.
+	for _, r := range []TokenRetriever{&aware, blocking} {
+		start := time.Now()
+		_, _, gotErr := Chain(r, TimeoutMiddleware(50*time.Millisecond)).RetrieveToken()
+		if !errors.Is(gotErr, wantErr) {
+			t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+		}
+		if gotDelay := time.Since(start); gotDelay > maxDelay {
+			t.Errorf("The call was not abandoned in time. Want less than '%v', Got '%v'", maxDelay, gotDelay)
+		}
+	}
+	select {
+	case <-aware.cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("The context aware call was not cancelled")
+	}
+}
+
+// blockingRetriever ignores cancellation and blocks until block is closed.
+type blockingRetriever struct {
+	block chan struct{}
+}
+
+func (r *blockingRetriever) RetrieveToken() (token string, expiresIn time.Duration, err error) {
+	<-r.block
+	return "", 0, mockRetrieverErr
+}
+
+func TestLoggingMiddlewareRedacts(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	secret := "superSecretToken123"
+
+	// Define logger.
+	var mu sync.Mutex
+	var logged []string
+	logger := log15.New()
+	logger.SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+		mu.Lock()
+		defer mu.Unlock()
+		logged = append(logged, string(log15.LogfmtFormat().Format(r)))
+		return nil
+	}))
+	r := Chain(&mockRetriever{token: secret, expiresIn: time.Hour}, LoggingMiddleware(logger))
+
+	// Test the results.
+	gotToken, _, gotErr := r.RetrieveToken()
+	if gotErr != nil || gotToken != secret {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v' '%v'", secret, gotToken, gotErr)
+	}
+	if len(logged) != 1 {
+		t.Fatalf("An unexpected number of lines were logged. Want '%v', Got '%v'", 1, len(logged))
+	}
+	if strings.Contains(logged[0], secret) {
+		t.Errorf("The token was logged. Got '%v'", logged[0])
+	}
+	if !strings.Contains(logged[0], fingerprint(secret)) {
+		t.Errorf("The token fingerprint was not logged. Want '%v', Got '%v'", fingerprint(secret), logged[0])
+	}
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantCalls := 3
+	wantErrors := 2
+
+	// Define retriever.
+	metrics := countingMetrics{}
+	r := Chain(&mockRetriever{numFails: 2, token: "newToken123", expiresIn: time.Hour}, MetricsMiddleware(&metrics))
+
+	// Test the results.
+	for i := 0; i < wantCalls; i++ {
+		r.RetrieveToken()
+	}
+	if metrics.calls != wantCalls || metrics.errors != wantErrors {
+		t.Errorf("An unexpected number of calls were observed. Want '%v' with '%v' errors, Got '%v' with '%v' errors", wantCalls, wantErrors, metrics.calls, metrics.errors)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	interval := 100 * time.Millisecond
+	wantMinDelay := 2 * interval // The burst of two is free, the next two calls wait an interval each.
+
+	// Define retriever.
+	r := Chain(&mockRetriever{token: "newToken123", expiresIn: time.Hour}, RateLimitMiddleware(interval, 2))
+
+	// Test the results.
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if _, _, gotErr := r.RetrieveToken(); gotErr != nil {
+			t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+		}
+	}
+	if gotDelay := time.Since(start); gotDelay < wantMinDelay-10*time.Millisecond {
+		t.Errorf("The calls were not rate limited. Want at least '%v', Got '%v'", wantMinDelay, gotDelay)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, gotErr := r.(ContextRetriever).RetrieveTokenContext(ctx); gotErr != context.Canceled {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", context.Canceled, gotErr)
+	}
+}
+
+func TestConcurrencyLimitMiddleware(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantMaxInFlight := 2
+
+	// Define retriever.
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	r := Chain(RetrieverFunc(func(ctx context.Context) (Token, error) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return Token{Value: "newToken123", Expiry: time.Now().Add(time.Hour)}, nil
+	}), ConcurrencyLimitMiddleware(wantMaxInFlight))
+
+	// Test the results.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.RetrieveToken()
+		}()
+	}
+	wg.Wait()
+	if maxInFlight != wantMaxInFlight {
+		t.Errorf("An unexpected number of calls were in flight. Want '%v', Got '%v'", wantMaxInFlight, maxInFlight)
+	}
+}
+
+func TestConcurrencyLimitMiddlewareZero(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "newToken123"
+
+	// Define retriever.
+	r := Chain(&mockRetriever{token: wantToken, expiresIn: time.Hour}, ConcurrencyLimitMiddleware(0))
+
+	// Test the results.
+	got := make(chan string, 1)
+	go func() {
+		gotToken, _, _ := r.RetrieveToken()
+		got <- gotToken
+	}()
+	select {
+	case gotToken := <-got:
+		if gotToken != wantToken {
+			t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("The call blocked with a limit of 0")
+	}
+}
+
+func TestJWTExpiryMiddleware(t *testing.T) {
+	t.Parallel()
+
+	// jwt returns an unsigned JWT expiring in exp.
+	jwt := func(exp time.Duration) string {
+		payload := fmt.Sprintf(`{"sub":"service1","exp":%d}`, time.Now().Add(exp).Unix())
+		return "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + "."
+	}
+
+	tests := []struct {
+		name          string
+		token         string
+		expiresIn     time.Duration
+		wantExpiresIn time.Duration
+		wantClaims    bool
+	}{
+		{"exp before reported expiry", jwt(10 * time.Minute), time.Hour, 10 * time.Minute, true},
+		{"reported expiry before exp", jwt(time.Hour), 5 * time.Minute, 5 * time.Minute, true},
+		{"reported expiry omitted", jwt(10 * time.Minute), 0, 10 * time.Minute, true},
+		{"not a JWT", "opaqueToken123", time.Hour, time.Hour, false},
+	}
+
+	for _, tt := range tests {
+		// Define retriever.
+		inner := RetrieverFunc(func(ctx context.Context) (Token, error) {
+			return Token{Value: tt.token, Expiry: time.Now().Add(tt.expiresIn)}, nil
+		})
+		r := Chain(inner, JWTExpiryMiddleware())
+
+		// Test the results.
+		gotToken, gotExpiresIn, gotErr := retrieveContext(context.Background(), r)
+		if gotErr != nil {
+			t.Errorf("%v: An unexpected error occurred. Want '%v', Got '%v'", tt.name, nil, gotErr)
+		}
+		if gotToken.Value != tt.token {
+			t.Errorf("%v: An unexpected token was returned. Want '%v', Got '%v'", tt.name, tt.token, gotToken.Value)
+		}
+		if gotExpiresIn > tt.wantExpiresIn || gotExpiresIn < tt.wantExpiresIn-2*time.Second {
+			t.Errorf("%v: An unexpected expiry was returned. Want '%v', Got '%v'", tt.name, tt.wantExpiresIn, gotExpiresIn)
+		}
+		if gotClaims := gotToken.Claims["sub"] == "service1"; gotClaims != tt.wantClaims {
+			t.Errorf("%v: Unexpected claims were returned. Want '%v', Got '%v'", tt.name, tt.wantClaims, gotToken.Claims)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package backoff
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultOAuthExpiry is the lifetime assumed for access tokens returned
+// without expires_in.
+const defaultOAuthExpiry = time.Hour
+
+// maxOAuthResponse limits how much of a token endpoint response is read.
+const maxOAuthResponse = 1 << 20
+
+// AuthStyle is how an OAuth2 client authenticates to the token endpoint.
+type AuthStyle int
+
+const (
+	// AuthStyleBasic sends the client credentials in an HTTP Basic
+	// Authorization header (client_secret_basic).
+	AuthStyleBasic AuthStyle = iota
+
+	// AuthStylePost sends the client credentials as client_id and
+	// client_secret form parameters (client_secret_post).
+	AuthStylePost
+
+	// AuthStylePrivateKeyJWT sends a JWT signed with the client's private
+	// key as a client assertion (private_key_jwt). It is set by
+	// WithOAuthPrivateKeyJWT.
+	AuthStylePrivateKeyJWT
+)
+
+// OAuthOption configures optional behavior of the OAuth2 retrievers.
+type OAuthOption func(*oauthClient)
+
+// WithOAuthScopes sets the scopes requested with each token.
+func WithOAuthScopes(scopes ...string) OAuthOption {
+	return func(c *oauthClient) {
+		c.scopes = scopes
+	}
+}
+
+// WithOAuthAuthStyle sets how the client authenticates. It defaults to
+// AuthStyleBasic.
+func WithOAuthAuthStyle(style AuthStyle) OAuthOption {
+	return func(c *oauthClient) {
+		c.authStyle = style
+	}
+}
+
+// WithOAuthEndpointParams sets extra form parameters sent with each request,
+// e.g. an audience or resource.
+func WithOAuthEndpointParams(params url.Values) OAuthOption {
+	return func(c *oauthClient) {
+		c.params = params
+	}
+}
+
+// WithOAuthHTTPClient sets the HTTP client used to call the token endpoint.
+// It defaults to http.DefaultClient.
+func WithOAuthHTTPClient(client *http.Client) OAuthOption {
+	return func(c *oauthClient) {
+		c.httpClient = client
+	}
+}
+
+// OAuthError is an error response from an OAuth2 token endpoint, as described
+// in RFC 6749 section 5.2. Retrievers return it wrapped with Permanent when
+// retrying can't help, e.g. for invalid_client, and otherwise as is, e.g. for
+// temporarily_unavailable, so use errors.As to inspect it.
+type OAuthError struct {
+	StatusCode  int    `json:"-"`
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+	URI         string `json:"error_uri"`
+}
+
+func (e *OAuthError) Error() string {
+	msg := fmt.Sprintf("oauth2: token endpoint returned %d %s", e.StatusCode, e.Code)
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	return msg
+}
+
+// permanentOAuthErrors are the error codes that retrying won't fix.
+var permanentOAuthErrors = map[string]bool{
+	"invalid_request":        true,
+	"invalid_client":         true,
+	"invalid_grant":          true,
+	"unauthorized_client":    true,
+	"unsupported_grant_type": true,
+	"invalid_scope":          true,
+}
+
+// ClientCredentialsRetriever retrieves tokens with the OAuth2 client
+// credentials grant.
+type ClientCredentialsRetriever struct {
+	client *oauthClient
+}
+
+// NewClientCredentialsRetriever creates a ClientCredentialsRetriever that
+// authenticates to tokenURL as clientID.
+func NewClientCredentialsRetriever(tokenURL, clientID, clientSecret string, opts ...OAuthOption) *ClientCredentialsRetriever {
+	return &ClientCredentialsRetriever{
+		client: newOAuthClient(tokenURL, clientID, clientSecret, opts),
+	}
+}
+
+// RetrieveToken implements TokenRetriever.
+func (r *ClientCredentialsRetriever) RetrieveToken() (token string, expiresIn time.Duration, err error) {
+	t, expiresIn, err := retrieveContext(context.Background(), r)
+	return t.Value, expiresIn, err
+}
+
+// RetrieveTokenContext implements ContextRetriever.
+func (r *ClientCredentialsRetriever) RetrieveTokenContext(ctx context.Context) (Token, error) {
+	res, err := r.client.exchange(ctx, url.Values{"grant_type": {"client_credentials"}})
+	if err != nil {
+		return Token{}, err
+	}
+	return res.token(), nil
+}
+
+// oauthClient makes requests to an OAuth2 token endpoint on behalf of the
+// retrievers for each grant type.
+type oauthClient struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	authStyle    AuthStyle
+	scopes       []string
+	params       url.Values
+	httpClient   *http.Client
+
+	assertionKey      crypto.Signer
+	keyID             string
+	assertionLifetime time.Duration
+}
+
+func newOAuthClient(tokenURL, clientID, clientSecret string, opts []OAuthOption) *oauthClient {
+	c := oauthClient{
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		httpClient:   http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return &c
+}
+
+// tokenResponse is a successful response from a token endpoint.
+type tokenResponse struct {
+	AccessToken  string      `json:"access_token"`
+	TokenType    string      `json:"token_type"`
+	ExpiresIn    json.Number `json:"expires_in"`
+	Scope        string      `json:"scope"`
+	RefreshToken string      `json:"refresh_token"`
+
+	received time.Time
+}
+
+// token returns the access token and its metadata.
+func (r *tokenResponse) token() Token {
+	expiresIn := defaultOAuthExpiry
+	if secs, err := r.ExpiresIn.Int64(); err == nil && secs > 0 {
+		expiresIn = time.Duration(secs) * time.Second
+	}
+	return Token{
+		Value:  r.AccessToken,
+		Expiry: r.received.Add(expiresIn),
+		Type:   r.TokenType,
+		Scope:  r.Scope,
+	}
+}
+
+// exchange posts form to the token endpoint, adding the client credentials,
+// scopes and extra parameters.
+//
+// Error responses are returned as *OAuthError, wrapped with Permanent if the
+// error code means retrying won't help. Transient errors carry the
+// Retry-After delay of the response, if any.
+func (c *oauthClient) exchange(ctx context.Context, form url.Values) (*tokenResponse, error) {
+	for k, v := range c.params {
+		form[k] = v
+	}
+	if len(c.scopes) > 0 {
+		form.Set("scope", strings.Join(c.scopes, " "))
+	}
+	switch c.authStyle {
+	case AuthStylePost:
+		form.Set("client_id", c.clientID)
+		if c.clientSecret != "" {
+			form.Set("client_secret", c.clientSecret)
+		}
+	case AuthStylePrivateKeyJWT:
+		assertion, err := c.clientAssertion()
+		if err != nil {
+			return nil, Permanent(err)
+		}
+		form.Set("client_id", c.clientID)
+		form.Set("client_assertion_type", clientAssertionType)
+		form.Set("client_assertion", assertion)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.authStyle == AuthStyleBasic && c.clientID != "" {
+		// RFC 6749 section 2.3.1 requires the credentials be form encoded
+		// first.
+		req.SetBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.clientSecret))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2: token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxOAuthResponse))
+	if err != nil {
+		return nil, fmt.Errorf("oauth2: reading token response failed: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, oauthError(resp, body)
+	}
+
+	res := tokenResponse{received: time.Now()}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("oauth2: parsing token response failed: %w", err)
+	}
+	if res.AccessToken == "" {
+		return nil, errors.New("oauth2: token response has no access_token")
+	}
+	return &res, nil
+}
+
+// oauthError converts an error response into an error classified for the
+// refresher.
+func oauthError(resp *http.Response, body []byte) error {
+	e := &OAuthError{StatusCode: resp.StatusCode}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		json.Unmarshal(body, e)
+	}
+	if e.Code == "" {
+		e.Code = "http_" + strconv.Itoa(resp.StatusCode)
+		if e.Description == "" {
+			e.Description = strings.TrimSpace(string(body))
+			if len(e.Description) > 200 {
+				e.Description = e.Description[:200] + "..."
+			}
+		}
+	}
+
+	if permanentOAuthErrors[e.Code] {
+		return Permanent(e)
+	}
+	if d, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+		return RetryAfter(e, d)
+	}
+	return e
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func parseRetryAfter(h string) (time.Duration, bool) {
+	if h == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(h); err == nil {
+		return time.Duration(secs) * time.Second, secs > 0
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		d := time.Until(t)
+		return d, d > 0
+	}
+	return 0, false
+}
@@ -0,0 +1,141 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// tokenEndpoint returns a token endpoint that checks requests with check and
+// responds with status and body.
+func tokenEndpoint(t *testing.T, status int, body string, check func(r *http.Request)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("The token request could not be parsed: %v", err)
+		}
+		if check != nil {
+			check(r)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+}
+
+func TestClientCredentialsRetrieverBasic(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := Token{Value: "accessToken123", Type: "Bearer", Scope: "read write"}
+	wantExpiresIn := time.Hour
+
+	// Define ClientCredentialsRetriever.
+	server := tokenEndpoint(t, http.StatusOK, `{"access_token":"accessToken123","token_type":"Bearer","expires_in":3600,"scope":"read write"}`, func(r *http.Request) {
+		if got := r.PostForm.Get("grant_type"); got != "client_credentials" {
+			t.Errorf("An unexpected grant type was requested. Want '%v', Got '%v'", "client_credentials", got)
+		}
+		if got := r.PostForm.Get("scope"); got != "read write" {
+			t.Errorf("An unexpected scope was requested. Want '%v', Got '%v'", "read write", got)
+		}
+		if id, secret, ok := r.BasicAuth(); !ok || id != "client%3A1" || secret != "s%26cret" {
+			t.Errorf("An unexpected Authorization header was sent. Want '%v', Got '%v'", "client%3A1:s%26cret", id+":"+secret)
+		}
+		if got := r.PostForm.Get("client_secret"); got != "" {
+			t.Errorf("The client secret was sent in the form. Want '%v', Got '%v'", "", got)
+		}
+	})
+	defer server.Close()
+	r := NewClientCredentialsRetriever(server.URL, "client:1", "s&cret", WithOAuthScopes("read", "write"))
+
+	// Test the results.
+	gotToken, gotErr := r.RetrieveTokenContext(context.Background())
+	if gotErr != nil {
+		t.Fatalf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+	}
+	if gotToken.Value != wantToken.Value || gotToken.Type != wantToken.Type || gotToken.Scope != wantToken.Scope {
+		t.Errorf("An unexpected token was returned. Want '%+v', Got '%+v'", wantToken, gotToken)
+	}
+	if gotExpiresIn := time.Until(gotToken.Expiry); gotExpiresIn > wantExpiresIn || gotExpiresIn < wantExpiresIn-time.Minute {
+		t.Errorf("An unexpected expiry was returned. Want '%v', Got '%v'", wantExpiresIn, gotExpiresIn)
+	}
+}
+
+func TestClientCredentialsRetrieverPost(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "accessToken123"
+
+	// Define ClientCredentialsRetriever.
+	server := tokenEndpoint(t, http.StatusOK, `{"access_token":"accessToken123","token_type":"Bearer","expires_in":"3600"}`, func(r *http.Request) {
+		if got := r.PostForm.Get("client_id"); got != "client1" {
+			t.Errorf("An unexpected client ID was sent. Want '%v', Got '%v'", "client1", got)
+		}
+		if got := r.PostForm.Get("client_secret"); got != "secret" {
+			t.Errorf("An unexpected client secret was sent. Want '%v', Got '%v'", "secret", got)
+		}
+		if got := r.PostForm.Get("audience"); got != "api" {
+			t.Errorf("An unexpected audience was sent. Want '%v', Got '%v'", "api", got)
+		}
+		if got := r.Header.Get("Authorization"); got != "" {
+			t.Errorf("An unexpected Authorization header was sent. Want '%v', Got '%v'", "", got)
+		}
+	})
+	defer server.Close()
+	r := NewClientCredentialsRetriever(server.URL, "client1", "secret", WithOAuthAuthStyle(AuthStylePost), WithOAuthEndpointParams(url.Values{"audience": {"api"}}))
+
+	// Test the results.
+	gotToken, gotExpiresIn, gotErr := r.RetrieveToken()
+	if gotErr != nil {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+	}
+	if gotToken != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken)
+	}
+	if gotExpiresIn <= 59*time.Minute {
+		t.Errorf("An unexpected expiry was returned. Want '%v', Got '%v'", time.Hour, gotExpiresIn)
+	}
+}
+
+func TestClientCredentialsRetrieverErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		status         int
+		body           string
+		wantCode       string
+		wantPermanent  bool
+		wantRetryAfter time.Duration
+	}{
+		{http.StatusUnauthorized, `{"error":"invalid_client","error_description":"Client authentication failed"}`, "invalid_client", true, 0},
+		{http.StatusBadRequest, `{"error":"invalid_scope"}`, "invalid_scope", true, 0},
+		{http.StatusServiceUnavailable, `{"error":"temporarily_unavailable"}`, "temporarily_unavailable", false, 5 * time.Second},
+		{http.StatusBadGateway, `<html>Bad Gateway</html>`, "http_502", false, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		// Define ClientCredentialsRetriever.
+		server := tokenEndpoint(t, tt.status, tt.body, nil)
+		r := NewClientCredentialsRetriever(server.URL, "client1", "secret")
+
+		// Test the results.
+		_, gotErr := r.RetrieveTokenContext(context.Background())
+		server.Close()
+
+		var oauthErr *OAuthError
+		if !errors.As(gotErr, &oauthErr) || oauthErr.Code != tt.wantCode || oauthErr.StatusCode != tt.status {
+			t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", tt.wantCode, gotErr)
+		}
+		if gotPermanent := IsPermanent(gotErr); gotPermanent != tt.wantPermanent {
+			t.Errorf("The %v error was misclassified. Want permanent '%v', Got '%v'", tt.wantCode, tt.wantPermanent, gotPermanent)
+		}
+		if gotRetryAfter, _ := retryAfter(gotErr); gotRetryAfter != tt.wantRetryAfter {
+			t.Errorf("An unexpected Retry-After delay was returned for %v. Want '%v', Got '%v'", tt.wantCode, tt.wantRetryAfter, gotRetryAfter)
+		}
+	}
+}
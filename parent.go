@@ -0,0 +1,176 @@
+package backoff
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrParentRevoked is returned by a refresher whose token was derived from a
+// parent token that has since been revoked, until it derives a new one.
+var ErrParentRevoked = errors.New("Token was derived from a revoked parent token")
+
+// WithParent declares that the refresher's tokens are derived from the tokens
+// of parent, e.g. because its retriever exchanges them. parent must be a
+// refresher created by this package, or a type embedding one.
+//
+// When parent gets a new token, the refresher derives a new one too, keeping
+// its current token if that fails. If parent's token is revoked, because
+// parent was force-refreshed or its token expired, the refresher is
+// force-refreshed and tokens derived from it are refused with
+// ErrParentRevoked until a new one has been derived.
+//
+// The refresher follows parent from when it starts until it is closed.
+func WithParent(parent TokenRefresher) Option {
+	return func(m *tokenRefresher) {
+		m.parent = parent.unwrap()
+	}
+}
+
+// unwrap implements TokenRefresher.
+func (m *tokenRefresher) unwrap() *tokenRefresher {
+	return m
+}
+
+// attach starts the refresher being notified by its parent. It is called when
+// the refresher starts, so that a refresher that is never run isn't kept by
+// its parent.
+func (m *tokenRefresher) attach() {
+	if m.parent == nil {
+		return
+	}
+	p := m.parent
+	p.childrenMu.Lock()
+	defer p.childrenMu.Unlock()
+	p.children = append(p.children, m)
+}
+
+// settled returns the current snapshot once no refresh is locking the token.
+func (m *tokenRefresher) settled() *tokenState {
+	s := m.load()
+	for s.refreshing != nil {
+		<-s.refreshing
+		s = m.load()
+	}
+	return s
+}
+
+// checkParent requests a new token if the parent has rotated since the stored
+// token was derived.
+func (m *tokenRefresher) checkParent() {
+	if m.parent == nil {
+		return
+	}
+	s, p := m.load(), m.parent.load()
+	switch {
+	case s.token == "":
+	case s.parentGeneration < p.validFrom:
+		m.requestRederive(p.validFrom, true)
+	case s.parentGeneration < p.generation:
+		m.requestRederive(p.generation, false)
+	}
+}
+
+// requestRederive asks the refresher to derive a new token from parent
+// generation target, force-refreshing it if the old parent token was revoked.
+// It only asks once per generation until a token is stored, so that reads
+// stay lock-free while the parent is being refreshed, and a failed re-derive
+// isn't retried on every read.
+func (m *tokenRefresher) requestRederive(target uint64, revoked bool) {
+	for {
+		requested := m.requested.Load()
+		if requested >= target {
+			return
+		}
+		if m.requested.CompareAndSwap(requested, target) {
+			break
+		}
+	}
+
+	if revoked {
+		m.Refresh("parent revoked")
+	} else {
+		m.parentRotated()
+	}
+}
+
+// parentRotated asks the refresher to derive a new token from its parent's
+// new one. Unlike Refresh, the stored token is neither revoked nor locked.
+func (m *tokenRefresher) parentRotated() {
+	if o := m.onDemand; o != nil {
+		o.mu.Lock()
+		o.rederive = true
+		o.mu.Unlock()
+		return
+	}
+
+	select {
+	case m.rotated <- struct{}{}:
+	default:
+	}
+}
+
+// rederive makes a single attempt to derive a new token after the parent
+// rotated, returning how long to wait before refreshing it. If the attempt
+// fails, the stored token is kept and the scheduled refresh is left to retry.
+func (m *tokenRefresher) rederive() (time.Duration, bool) {
+	m.setReason("parent rotated")
+	token, expiresIn, err := m.retrieve(m.done)
+	if err != nil {
+		select {
+		case <-m.done:
+			return 0, false
+		default:
+		}
+		m.onError(err, false)
+		m.logger.Error("Failed to derive token from rotated parent. Keeping current token", "err", err)
+		return 0, false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock() // Hooks may panic.
+	m.setToken(token, expiresIn)
+	m.onRefresh(token.Value, expiresIn)
+	return m.nextRefresh(expiresIn), true
+}
+
+// revoked reports whether s was derived from a parent token that has been
+// revoked.
+func (m *tokenRefresher) revoked(s *tokenState) bool {
+	return m.parent != nil && s.parentGeneration < m.parent.load().validFrom
+}
+
+// revoke marks the stored token as revoked, so that tokens derived from it are
+// refused. It must be called with the lock held.
+func (m *tokenRefresher) revoke() {
+	m.update(func(s *tokenState) {
+		s.validFrom = s.generation + 1
+	})
+	m.notifyChildren(m.load().validFrom, true)
+}
+
+// notifyChildren asks the refreshers deriving tokens from this one to derive
+// new ones from generation target. If the old token was revoked, they are
+// force-refreshed.
+func (m *tokenRefresher) notifyChildren(target uint64, revoked bool) {
+	m.childrenMu.Lock()
+	defer m.childrenMu.Unlock()
+	for _, child := range m.children {
+		child.requestRederive(target, revoked)
+	}
+}
+
+// detach stops the refresher being notified by its parent.
+func (m *tokenRefresher) detach() {
+	if m.parent == nil {
+		return
+	}
+	p := m.parent
+	p.childrenMu.Lock()
+	defer p.childrenMu.Unlock()
+	for i, child := range p.children {
+		if child == m {
+			p.children = append(p.children[:i], p.children[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package backoff
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+func TestParentRotationCascades(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantTokens := []string{"child-parentToken01", "child-parentToken02"}
+
+	// Define tokenRefresher services.
+	parentRetriever := mockRetriever{
+		token:          "parentToken",
+		incrementToken: true,
+		expiresIn:      time.Hour,
+	}
+	parent := NewTokenRefresher(log15.New("global", "backoff_test"), time.Minute, &parentRetriever)
+	defer parent.Close()
+	childRetriever := RetrieverFunc(func(ctx context.Context) (Token, error) {
+		parentToken, err := parent.GetToken()
+		if err != nil {
+			return Token{}, err
+		}
+		return Token{Value: "child-" + parentToken, Expiry: time.Now().Add(time.Hour)}, nil
+	})
+	time.Sleep(50 * time.Millisecond)
+	child := NewTokenRefresher(log15.New("global", "backoff_test"), time.Minute, childRetriever, WithParent(parent))
+	defer child.Close()
+
+	// Test the results.
+	for i, wantToken := range wantTokens {
+		if i > 0 {
+			parent.Refresh("test")
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		gotToken, gotErr := child.GetToken()
+		if gotErr != nil {
+			t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+		}
+		if gotToken != wantToken {
+			t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken)
+		}
+	}
+}
+
+func TestParentRotationRederiveFails(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "childToken01"
+	wantCalled := int32(2)
+
+	// Define tokenRefresher services.
+	parent := tokenRefresher{
+		logger: log15.New("global", "backoff_test"),
+		done:   make(chan struct{}),
+		force:  make(chan struct{}),
+	}
+	parent.setToken(Token{Value: "parentToken01"}, time.Hour)
+	var called atomic.Int32
+	childRetriever := RetrieverFunc(func(ctx context.Context) (Token, error) {
+		if called.Add(1) > 1 {
+			return Token{}, mockRetrieverErr
+		}
+		return Token{Value: wantToken, Expiry: time.Now().Add(time.Hour)}, nil
+	})
+	child := NewTokenRefresher(log15.New("global", "backoff_test"), time.Minute, childRetriever, WithParent(&parent))
+	defer child.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	// Test the results.
+	parent.lock()
+	parent.setToken(Token{Value: "parentToken02"}, time.Hour) // A scheduled rotation.
+	parent.unlock()
+	time.Sleep(50 * time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		got := make(chan string, 1)
+		go func() {
+			gotToken, gotErr := child.GetToken()
+			if gotErr != nil {
+				t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+			}
+			got <- gotToken
+		}()
+		select {
+		case gotToken := <-got:
+			if gotToken != wantToken {
+				t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("GetToken blocked after a failed re-derive")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if gotCalled := called.Load(); gotCalled != wantCalled {
+		t.Errorf("The retriever was called an unexpected number of times. Want '%v', Got '%v'", wantCalled, gotCalled)
+	}
+}
+
+func TestParentRotationHookPanic(t *testing.T) {
+	t.Parallel()
+
+	// Define tokenRefresher services.
+	parent := tokenRefresher{
+		logger: log15.New("global", "backoff_test"),
+		done:   make(chan struct{}),
+		force:  make(chan struct{}),
+	}
+	parent.setToken(Token{Value: "parentToken01"}, time.Hour)
+	childRetriever := mockRetriever{
+		token:     "childToken",
+		expiresIn: time.Hour,
+	}
+	var refreshes atomic.Int32
+	child := NewTokenRefresher(log15.New("global", "backoff_test"), time.Minute, &childRetriever, WithParent(&parent), WithHooks(Hooks{
+		OnRefresh: func(token string, expiresIn time.Duration) {
+			if refreshes.Add(1) == 2 {
+				panic("hook panic")
+			}
+		},
+	}))
+	time.Sleep(50 * time.Millisecond)
+
+	// Test the results.
+	parent.lock()
+	parent.setToken(Token{Value: "parentToken02"}, time.Hour) // The child's re-derive panics in the hook.
+	parent.unlock()
+	time.Sleep(1500 * time.Millisecond) // Longer than the first restart delay.
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if gotErr := child.CloseContext(ctx); gotErr != nil {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+	}
+}
+
+func TestParentRevokedRefused(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantErr := ErrParentRevoked
+
+	// Define tokenRefresher services.
+	parent := tokenRefresher{
+		logger: log15.New("global", "backoff_test"),
+		done:   make(chan struct{}),
+		force:  make(chan struct{}),
+	}
+	parent.setToken(Token{Value: "parentToken01"}, time.Hour)
+	child := tokenRefresher{
+		logger: log15.New("global", "backoff_test"),
+		done:   make(chan struct{}),
+		force:  make(chan struct{}),
+	}
+	WithParent(&parent)(&child)
+	child.derivedFrom.Store(parent.load().generation)
+	child.setToken(Token{Value: "childToken01"}, time.Hour)
+
+	// Test the results.
+	parent.lock()
+	parent.setToken(Token{Value: "parentToken02"}, time.Hour) // A scheduled rotation doesn't revoke the old token.
+	parent.unlock()
+	if _, gotErr := child.GetToken(); gotErr != nil {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+	}
+
+	parent.lock()
+	parent.revoke()
+	parent.setToken(Token{Value: "parentToken03"}, time.Hour)
+	parent.unlock()
+	if _, gotErr := child.GetToken(); gotErr != wantErr {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+	}
+
+	child.derivedFrom.Store(parent.load().generation)
+	child.setToken(Token{Value: "childToken02"}, time.Hour)
+	if _, gotErr := child.GetToken(); gotErr != nil {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+	}
+}
+
+func TestParentRevokedRequestedOnce(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantErr := ErrParentRevoked
+	wantRequests := int32(1)
+
+	// Define tokenRefresher services.
+	parent := tokenRefresher{
+		logger: log15.New("global", "backoff_test"),
+		done:   make(chan struct{}),
+		force:  make(chan struct{}),
+	}
+	parent.setToken(Token{Value: "parentToken01"}, time.Hour)
+	child := tokenRefresher{
+		logger: log15.New("global", "backoff_test"),
+		done:   make(chan struct{}),
+		force:  make(chan struct{}),
+	}
+	WithParent(&parent)(&child)
+	child.attach()
+	child.derivedFrom.Store(parent.load().generation)
+	child.setToken(Token{Value: "childToken01"}, time.Hour)
+	var requests atomic.Int32
+	go func() {
+		for {
+			select {
+			case <-child.force:
+				requests.Add(1)
+			case <-child.done:
+				return
+			}
+		}
+	}()
+	defer child.Close()
+	time.Sleep(10 * time.Millisecond)
+
+	// Test the results.
+	parent.lock()
+	parent.revoke()
+	parent.unlock()
+	for i := 0; i < 10; i++ {
+		if _, gotErr := child.GetToken(); gotErr != wantErr {
+			t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if gotRequests := requests.Load(); gotRequests != wantRequests {
+		t.Errorf("A refresh was requested an unexpected number of times. Want '%v', Got '%v'", wantRequests, gotRequests)
+	}
+}
+
+func TestWithParentWrapped(t *testing.T) {
+	t.Parallel()
+
+	// Define tokenRefresher services.
+	parent := NewTokenRefresher(log15.New("global", "backoff_test"), time.Minute, &mockRetriever{token: "parentToken", expiresIn: time.Hour})
+	defer parent.Close()
+	child := NewRunnableTokenRefresher(log15.New("global", "backoff_test"), time.Minute, &mockRetriever{token: "childToken", expiresIn: time.Hour}, WithParent(wrappedRefresher{parent}))
+	children := func() int {
+		p := parent.unwrap()
+		p.childrenMu.Lock()
+		defer p.childrenMu.Unlock()
+		return len(p.children)
+	}
+
+	// Test the results.
+	if got := children(); got != 0 {
+		t.Errorf("A child that isn't running was registered. Want '%v', Got '%v'", 0, got)
+	}
+	go child.Run(context.Background())
+	time.Sleep(50 * time.Millisecond)
+	if got := children(); got != 1 {
+		t.Errorf("A running child wasn't registered. Want '%v', Got '%v'", 1, got)
+	}
+	child.CloseContext(context.Background())
+	if got := children(); got != 0 {
+		t.Errorf("A closed child is still registered. Want '%v', Got '%v'", 0, got)
+	}
+}
+
+// wrappedRefresher is a TokenRefresher decorating one created by this package.
+type wrappedRefresher struct {
+	TokenRefresher
+}
@@ -0,0 +1,71 @@
+package backoff
+
+import (
+	"crypto"
+	"time"
+)
+
+// clientAssertionType is the client_assertion_type of a JWT client assertion,
+// from RFC 7523 section 2.2.
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// defaultAssertionLifetime is how long a client assertion is valid for by
+// default. Assertions are signed for every request, so it only needs to cover
+// clock skew and the request itself.
+const defaultAssertionLifetime = 5 * time.Minute
+
+// WithOAuthPrivateKeyJWT makes the client authenticate with private_key_jwt
+// (RFC 7523): each request carries a new, short-lived JWT client assertion
+// signed with key, which must be an RSA, ECDSA or Ed25519 key. keyID is sent
+// as the kid header if it isn't empty. The client secret is not sent.
+func WithOAuthPrivateKeyJWT(key crypto.Signer, keyID string) OAuthOption {
+	return func(c *oauthClient) {
+		c.authStyle = AuthStylePrivateKeyJWT
+		c.assertionKey = key
+		c.keyID = keyID
+	}
+}
+
+// WithOAuthAssertionLifetime sets how long client assertions are valid for. It
+// defaults to five minutes.
+func WithOAuthAssertionLifetime(lifetime time.Duration) OAuthOption {
+	return func(c *oauthClient) {
+		c.assertionLifetime = lifetime
+	}
+}
+
+// NewPrivateKeyJWTRetriever creates a ClientCredentialsRetriever that
+// authenticates to tokenURL as clientID with private_key_jwt, signing client
+// assertions with the private key in keyPEM. See ParsePrivateKeyPEM for the
+// supported keys.
+func NewPrivateKeyJWTRetriever(tokenURL, clientID string, keyPEM []byte, keyID string, opts ...OAuthOption) (*ClientCredentialsRetriever, error) {
+	key, err := ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	opts = append([]OAuthOption{WithOAuthPrivateKeyJWT(key, keyID)}, opts...)
+	return NewClientCredentialsRetriever(tokenURL, clientID, "", opts...), nil
+}
+
+// clientAssertion returns a new client assertion identifying the client to
+// the token endpoint.
+func (c *oauthClient) clientAssertion() (string, error) {
+	lifetime := c.assertionLifetime
+	if lifetime <= 0 {
+		lifetime = defaultAssertionLifetime
+	}
+	jti, err := jwtID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	return signJWT(c.assertionKey, c.keyID, map[string]interface{}{
+		"iss": c.clientID,
+		"sub": c.clientID,
+		"aud": c.tokenURL,
+		"jti": jti,
+		"iat": now.Unix(),
+		"exp": now.Add(lifetime).Unix(),
+	})
+}
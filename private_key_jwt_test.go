@@ -0,0 +1,64 @@
+package backoff
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPrivateKeyJWTRetriever(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range testKeys(t) {
+		// Define expectations.
+		wantToken := "accessToken123"
+		wantClientID := "client1"
+
+		// Define PrivateKeyJWTRetriever.
+		var assertion string
+		server := tokenEndpoint(t, http.StatusOK, `{"access_token":"accessToken123","token_type":"Bearer","expires_in":3600}`, func(r *http.Request) {
+			if got := r.PostForm.Get("client_assertion_type"); got != clientAssertionType {
+				t.Errorf("An unexpected assertion type was sent. Want '%v', Got '%v'", clientAssertionType, got)
+			}
+			if got := r.PostForm.Get("client_id"); got != wantClientID {
+				t.Errorf("An unexpected client ID was sent. Want '%v', Got '%v'", wantClientID, got)
+			}
+			if _, _, ok := r.BasicAuth(); ok {
+				t.Errorf("An unexpected Authorization header was sent")
+			}
+			assertion = r.PostForm.Get("client_assertion")
+		})
+		r, err := NewPrivateKeyJWTRetriever(server.URL, wantClientID, tt.pem, "key1")
+		if err != nil {
+			t.Fatalf("An unexpected error occurred. Want '%v', Got '%v'", nil, err)
+		}
+
+		// Test the results.
+		gotToken, gotErr := r.RetrieveTokenContext(context.Background())
+		server.Close()
+		if gotErr != nil {
+			t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+		}
+		if gotToken.Value != wantToken {
+			t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken.Value)
+		}
+
+		key, _ := ParsePrivateKeyPEM(tt.pem)
+		header, claims := verifyJWT(t, assertion, key)
+		if header["alg"] != tt.wantAlg {
+			t.Errorf("An unexpected algorithm was used. Want '%v', Got '%v'", tt.wantAlg, header["alg"])
+		}
+		if claims["iss"] != wantClientID || claims["sub"] != wantClientID || claims["aud"] != server.URL {
+			t.Errorf("Unexpected claims were sent. Want '%v' '%v' '%v', Got '%v' '%v' '%v'", wantClientID, wantClientID, server.URL, claims["iss"], claims["sub"], claims["aud"])
+		}
+		if jti, _ := claims["jti"].(string); jti == "" {
+			t.Errorf("The assertion has no jti claim")
+		}
+		iat, _ := claims["iat"].(float64)
+		exp, _ := claims["exp"].(float64)
+		if gotLifetime := time.Duration(exp-iat) * time.Second; gotLifetime != defaultAssertionLifetime {
+			t.Errorf("The assertion has an unexpected lifetime. Want '%v', Got '%v'", defaultAssertionLifetime, gotLifetime)
+		}
+	}
+}
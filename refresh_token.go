@@ -0,0 +1,127 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrNoRefreshToken is returned by RefreshTokenRetriever when the store has no
+// refresh token, so the user needs to authenticate.
+var ErrNoRefreshToken = errors.New("oauth2: no refresh token")
+
+// RefreshTokenStore persists the refresh token used by a RefreshTokenRetriever,
+// so that a rotated refresh token survives restarts.
+type RefreshTokenStore interface {
+	// LoadRefreshToken returns the stored refresh token, or "" if there is
+	// none.
+	LoadRefreshToken(ctx context.Context) (string, error)
+
+	// SaveRefreshToken replaces the stored refresh token.
+	SaveRefreshToken(ctx context.Context, refreshToken string) error
+}
+
+// NewMemoryRefreshTokenStore returns a RefreshTokenStore that keeps the
+// refresh token in memory, starting with refreshToken.
+func NewMemoryRefreshTokenStore(refreshToken string) RefreshTokenStore {
+	return &memoryRefreshTokenStore{refreshToken: refreshToken}
+}
+
+type memoryRefreshTokenStore struct {
+	mu           sync.Mutex
+	refreshToken string
+}
+
+func (s *memoryRefreshTokenStore) LoadRefreshToken(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refreshToken, nil
+}
+
+func (s *memoryRefreshTokenStore) SaveRefreshToken(ctx context.Context, refreshToken string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshToken = refreshToken
+	return nil
+}
+
+// RefreshTokenRetriever retrieves tokens with the OAuth2 refresh token grant,
+// for user delegated access.
+//
+// If the token endpoint rotates the refresh token, the new one is saved to the
+// store before the access token is returned. If saving fails, the access token
+// is discarded and an error returned; the new refresh token is kept in memory
+// and saving is retried by the next attempt. Calls are serialized, since a
+// rotated refresh token can only be used once.
+//
+// An invalid_grant error, meaning the refresh token has expired or been
+// revoked, is permanent: the user needs to authenticate again. The next
+// attempt, e.g. after Refresh is called, reloads the refresh token from the
+// store.
+type RefreshTokenRetriever struct {
+	client *oauthClient
+	store  RefreshTokenStore
+
+	mu           sync.Mutex
+	refreshToken string // Cached copy of the stored refresh token.
+	unsaved      bool   // refreshToken was rotated but couldn't be saved.
+}
+
+// NewRefreshTokenRetriever creates a RefreshTokenRetriever that authenticates
+// to tokenURL as clientID, using the refresh token kept in store.
+func NewRefreshTokenRetriever(tokenURL, clientID, clientSecret string, store RefreshTokenStore, opts ...OAuthOption) *RefreshTokenRetriever {
+	return &RefreshTokenRetriever{
+		client: newOAuthClient(tokenURL, clientID, clientSecret, opts),
+		store:  store,
+	}
+}
+
+// RetrieveToken implements TokenRetriever.
+func (r *RefreshTokenRetriever) RetrieveToken() (token string, expiresIn time.Duration, err error) {
+	t, expiresIn, err := retrieveContext(context.Background(), r)
+	return t.Value, expiresIn, err
+}
+
+// RetrieveTokenContext implements ContextRetriever.
+func (r *RefreshTokenRetriever) RetrieveTokenContext(ctx context.Context) (Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.refreshToken == "" {
+		refreshToken, err := r.store.LoadRefreshToken(ctx)
+		if err != nil {
+			return Token{}, fmt.Errorf("oauth2: loading refresh token failed: %w", err)
+		}
+		if refreshToken == "" {
+			return Token{}, Permanent(ErrNoRefreshToken)
+		}
+		r.refreshToken = refreshToken
+	}
+
+	res, err := r.client.exchange(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {r.refreshToken},
+	})
+	if err != nil {
+		var oauthErr *OAuthError
+		if errors.As(err, &oauthErr) && oauthErr.Code == "invalid_grant" {
+			r.refreshToken, r.unsaved = "", false
+		}
+		return Token{}, err
+	}
+
+	if res.RefreshToken != "" && res.RefreshToken != r.refreshToken {
+		r.refreshToken = res.RefreshToken // The old one may no longer be valid.
+		r.unsaved = true
+	}
+	if r.unsaved {
+		if err := r.store.SaveRefreshToken(ctx, r.refreshToken); err != nil {
+			return Token{}, fmt.Errorf("oauth2: saving rotated refresh token failed: %w", err)
+		}
+		r.unsaved = false
+	}
+	return res.token(), nil
+}
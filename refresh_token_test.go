@@ -0,0 +1,115 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// failingStore is a RefreshTokenStore whose saves fail while failSaves is set.
+type failingStore struct {
+	RefreshTokenStore
+	failSaves bool
+}
+
+func (s *failingStore) SaveRefreshToken(ctx context.Context, refreshToken string) error {
+	if s.failSaves {
+		return errors.New("disk full")
+	}
+	return s.RefreshTokenStore.SaveRefreshToken(ctx, refreshToken)
+}
+
+func TestRefreshTokenRetrieverRotation(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "accessToken123"
+	wantRefreshTokens := []string{"refreshToken1", "refreshToken2"}
+
+	// Define RefreshTokenRetriever.
+	var gotRefreshTokens []string
+	server := tokenEndpoint(t, http.StatusOK, `{"access_token":"accessToken123","token_type":"Bearer","expires_in":3600,"refresh_token":"refreshToken2"}`, func(r *http.Request) {
+		if got := r.PostForm.Get("grant_type"); got != "refresh_token" {
+			t.Errorf("An unexpected grant type was requested. Want '%v', Got '%v'", "refresh_token", got)
+		}
+		gotRefreshTokens = append(gotRefreshTokens, r.PostForm.Get("refresh_token"))
+	})
+	defer server.Close()
+	store := NewMemoryRefreshTokenStore("refreshToken1")
+	r := NewRefreshTokenRetriever(server.URL, "client1", "secret", store)
+
+	// Test the results.
+	for i := 0; i < 2; i++ {
+		gotToken, gotErr := r.RetrieveTokenContext(context.Background())
+		if gotErr != nil {
+			t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+		}
+		if gotToken.Value != wantToken {
+			t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken.Value)
+		}
+	}
+	if len(gotRefreshTokens) != 2 || gotRefreshTokens[0] != wantRefreshTokens[0] || gotRefreshTokens[1] != wantRefreshTokens[1] {
+		t.Errorf("Unexpected refresh tokens were used. Want '%v', Got '%v'", wantRefreshTokens, gotRefreshTokens)
+	}
+	if gotStored, _ := store.LoadRefreshToken(context.Background()); gotStored != "refreshToken2" {
+		t.Errorf("The rotated refresh token was not stored. Want '%v', Got '%v'", "refreshToken2", gotStored)
+	}
+}
+
+func TestRefreshTokenRetrieverSaveFails(t *testing.T) {
+	t.Parallel()
+
+	// Define RefreshTokenRetriever.
+	server := tokenEndpoint(t, http.StatusOK, `{"access_token":"accessToken123","expires_in":3600,"refresh_token":"refreshToken2"}`, nil)
+	defer server.Close()
+	store := failingStore{RefreshTokenStore: NewMemoryRefreshTokenStore("refreshToken1"), failSaves: true}
+	r := NewRefreshTokenRetriever(server.URL, "client1", "secret", &store)
+
+	// Test the results.
+	_, gotErr := r.RetrieveTokenContext(context.Background())
+	if gotErr == nil || IsPermanent(gotErr) {
+		t.Errorf("An unexpected error occurred. Want a transient error, Got '%v'", gotErr)
+	}
+
+	store.failSaves = false
+	_, gotErr = r.RetrieveTokenContext(context.Background()) // The endpoint doesn't rotate again, but the save is retried.
+	if gotErr != nil {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+	}
+	if gotStored, _ := store.LoadRefreshToken(context.Background()); gotStored != "refreshToken2" {
+		t.Errorf("The rotated refresh token was not stored. Want '%v', Got '%v'", "refreshToken2", gotStored)
+	}
+}
+
+func TestRefreshTokenRetrieverInvalidGrant(t *testing.T) {
+	t.Parallel()
+
+	// Define RefreshTokenRetriever.
+	server := tokenEndpoint(t, http.StatusBadRequest, `{"error":"invalid_grant","error_description":"Refresh token revoked"}`, nil)
+	defer server.Close()
+	r := NewRefreshTokenRetriever(server.URL, "client1", "secret", NewMemoryRefreshTokenStore("refreshToken1"))
+
+	// Test the results.
+	_, gotErr := r.RetrieveTokenContext(context.Background())
+	var oauthErr *OAuthError
+	if !IsPermanent(gotErr) || !errors.As(gotErr, &oauthErr) || oauthErr.Code != "invalid_grant" {
+		t.Errorf("An unexpected error occurred. Want a permanent invalid_grant error, Got '%v'", gotErr)
+	}
+}
+
+func TestRefreshTokenRetrieverNoRefreshToken(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantErr := ErrNoRefreshToken
+
+	// Define RefreshTokenRetriever.
+	r := NewRefreshTokenRetriever("http://127.0.0.1:0", "client1", "secret", NewMemoryRefreshTokenStore(""))
+
+	// Test the results.
+	_, gotErr := r.RetrieveTokenContext(context.Background())
+	if !IsPermanent(gotErr) || !errors.Is(gotErr, wantErr) {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", wantErr, gotErr)
+	}
+}
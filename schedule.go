@@ -0,0 +1,65 @@
+package backoff
+
+import "time"
+
+// minRefreshDelay is the shortest time the refresher waits between successful
+// refreshes, so that a retriever returning already expired tokens can't send
+// it into a tight loop.
+const minRefreshDelay = time.Second
+
+// WithRefreshFraction schedules each refresh once fraction of the token's
+// lifetime has elapsed, e.g. 0.75 refreshes a 1h token after 45m and a 5m
+// token after 3m45s, instead of a fixed refreshBuffer before expiry. The
+// resulting buffer is clamped to [minBuffer, maxBuffer]; a zero bound is
+// ignored.
+func WithRefreshFraction(fraction float64, minBuffer, maxBuffer time.Duration) Option {
+	return func(m *tokenRefresher) {
+		m.refreshFraction = fraction
+		m.minBuffer = minBuffer
+		m.maxBuffer = maxBuffer
+	}
+}
+
+// nextRefresh records the refresh buffer for a token that expires in
+// expiresIn and returns how long to wait before refreshing it.
+func (m *tokenRefresher) nextRefresh(expiresIn time.Duration) time.Duration {
+	m.buffer = m.bufferFor(expiresIn)
+
+	d := expiresIn - m.buffer
+	if d < minRefreshDelay {
+		d = minRefreshDelay
+	}
+	return d
+}
+
+// bufferFor returns how long before expiry a token that expires in expiresIn
+// should be refreshed.
+func (m *tokenRefresher) bufferFor(expiresIn time.Duration) time.Duration {
+	buffer := m.refreshBuffer
+	if m.refreshFraction > 0 && m.refreshFraction < 1 {
+		buffer = time.Duration(float64(expiresIn) * (1 - m.refreshFraction))
+		if m.minBuffer > 0 && buffer < m.minBuffer {
+			buffer = m.minBuffer
+		}
+		if m.maxBuffer > 0 && buffer > m.maxBuffer {
+			buffer = m.maxBuffer
+		}
+	}
+
+	if buffer >= expiresIn {
+		// Refreshing a full buffer before expiry would mean refreshing
+		// immediately, so refresh at half-life instead.
+		m.logger.Warn("Token lifetime is shorter than the refresh buffer. Refreshing at half-life", "expiresIn", expiresIn, "refreshBuffer", buffer)
+		buffer = expiresIn / 2
+	}
+	return buffer
+}
+
+// currentBuffer returns the refresh buffer of the current token, or the
+// configured refreshBuffer if no token has been retrieved yet.
+func (m *tokenRefresher) currentBuffer() time.Duration {
+	if m.buffer > 0 {
+		return m.buffer
+	}
+	return m.refreshBuffer
+}
@@ -0,0 +1,68 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+func TestNextRefreshFraction(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	tests := []struct {
+		expiresIn  time.Duration
+		wantDelay  time.Duration
+		wantBuffer time.Duration
+	}{
+		{time.Hour, 45 * time.Minute, 15 * time.Minute},
+		{5 * time.Minute, 3 * time.Minute, 2 * time.Minute},               // Clamped to the min buffer.
+		{12 * time.Hour, 11*time.Hour + 30*time.Minute, 30 * time.Minute}, // Clamped to the max buffer.
+	}
+
+	// Define tokenRefresher service.
+	m := tokenRefresher{
+		logger:        log15.New("global", "backoff_test"),
+		refreshBuffer: 5 * time.Minute,
+	}
+	WithRefreshFraction(0.75, 2*time.Minute, 30*time.Minute)(&m)
+
+	// Test the results.
+	for _, tt := range tests {
+		gotDelay := m.nextRefresh(tt.expiresIn)
+		if gotDelay != tt.wantDelay {
+			t.Errorf("An unexpected refresh delay was returned for '%v'. Want '%v', Got '%v'", tt.expiresIn, tt.wantDelay, gotDelay)
+		}
+		if m.currentBuffer() != tt.wantBuffer {
+			t.Errorf("An unexpected refresh buffer was recorded for '%v'. Want '%v', Got '%v'", tt.expiresIn, tt.wantBuffer, m.currentBuffer())
+		}
+	}
+}
+
+func TestNextRefreshShortLifetime(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	tests := []struct {
+		expiresIn time.Duration
+		wantDelay time.Duration
+	}{
+		{2 * time.Minute, time.Minute}, // Shorter than the refresh buffer, so refresh at half-life.
+		{time.Second, minRefreshDelay},
+		{0, minRefreshDelay},
+	}
+
+	// Define tokenRefresher service.
+	m := tokenRefresher{
+		logger:        log15.New("global", "backoff_test"),
+		refreshBuffer: 5 * time.Minute,
+	}
+
+	// Test the results.
+	for _, tt := range tests {
+		if gotDelay := m.nextRefresh(tt.expiresIn); gotDelay != tt.wantDelay {
+			t.Errorf("An unexpected refresh delay was returned for '%v'. Want '%v', Got '%v'", tt.expiresIn, tt.wantDelay, gotDelay)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package backoff
+
+import "time"
+
+// tokenState is an immutable snapshot of the stored token. Writers publish a
+// new snapshot on every change, so readers never need a lock.
+type tokenState struct {
+	token     string
+	source    string
+	tokenType string
+	scope     string
+	claims    map[string]interface{}
+	expiry    time.Time
+	stale     bool
+	err       error
+
+	// generation counts the tokens stored, and tokens derived from ones
+	// before validFrom are refused. parentGeneration is the generation of
+	// the parent token the token was derived from.
+	generation       uint64
+	validFrom        uint64
+	parentGeneration uint64
+
+	// refreshing is non-nil while a refresh is locking the token, and is
+	// closed once the refresh has published its result. Readers wait on it
+	// before using the snapshot.
+	refreshing chan struct{}
+}
+
+// emptyState is the state of a refresher that has never stored a token.
+var emptyState = &tokenState{}
+
+// load returns the current snapshot of the token state.
+func (m *tokenRefresher) load() *tokenState {
+	if s := m.state.Load(); s != nil {
+		return s
+	}
+	return emptyState
+}
+
+// update publishes a copy of the current snapshot with f applied to it. It
+// must be called with mu held.
+func (m *tokenRefresher) update(f func(s *tokenState)) {
+	s := *m.load()
+	f(&s)
+	m.state.Store(&s)
+}
+
+// lock makes readers wait until unlock is called, e.g. while a forced refresh
+// retrieves a new token to replace one known to be bad.
+func (m *tokenRefresher) lock() {
+	m.mu.Lock()
+	m.update(func(s *tokenState) {
+		s.refreshing = make(chan struct{})
+	})
+}
+
+// unlock publishes the state left by the refresh and releases the readers
+// waiting on it.
+func (m *tokenRefresher) unlock() {
+	refreshing := m.load().refreshing
+	m.update(func(s *tokenState) {
+		s.refreshing = nil
+	})
+	close(refreshing)
+	m.mu.Unlock()
+}
@@ -0,0 +1,95 @@
+package backoff
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+func TestTokenWaitsForUnlock(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "newToken123"
+	readers := 10
+
+	// Define tokenRefresher service.
+	m := tokenRefresher{
+		logger: log15.New("global", "backoff_test"),
+	}
+	m.setToken(Token{Value: "cachedToken123"}, time.Hour)
+
+	// Test the results.
+	m.lock()
+	m.expire()
+
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gotToken, gotErr := m.GetToken() // This should only return once the lock is released.
+			if gotErr != nil || gotToken != wantToken {
+				t.Errorf("An unexpected token was returned. Want '%v', Got '%v' '%v'", wantToken, gotToken, gotErr)
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	m.setToken(Token{Value: wantToken}, time.Hour)
+	m.unlock()
+	wg.Wait()
+}
+
+// BenchmarkGetToken measures GetToken throughput with one reader per
+// GOMAXPROCS. Run with -cpu 1,2,4,8 to see it scale.
+func BenchmarkGetToken(b *testing.B) {
+	m := tokenRefresher{
+		logger: log15.New("global", "backoff_test"),
+	}
+	m.setToken(Token{Value: "cachedToken123"}, time.Hour)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := m.GetToken(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkGetTokenDuringRefresh measures GetToken throughput while the token
+// is replaced as fast as possible by a timed refresh.
+func BenchmarkGetTokenDuringRefresh(b *testing.B) {
+	m := tokenRefresher{
+		logger: log15.New("global", "backoff_test"),
+	}
+	m.setToken(Token{Value: "cachedToken123"}, time.Hour)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			m.mu.Lock()
+			m.setToken(Token{Value: "newToken123"}, time.Hour)
+			m.mu.Unlock()
+		}
+	}()
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := m.GetToken(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Token type identifiers from RFC 8693 section 3.
+const (
+	TokenTypeAccessToken  = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeRefreshToken = "urn:ietf:params:oauth:token-type:refresh_token"
+	TokenTypeIDToken      = "urn:ietf:params:oauth:token-type:id_token"
+	TokenTypeJWT          = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// tokenExchangeGrantType is the grant_type of an RFC 8693 token exchange.
+const tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// TokenExchangeRetriever exchanges a subject token, such as an upstream
+// identity token, for a token for another audience with the OAuth2 token
+// exchange grant (RFC 8693). The subject token is taken from another
+// TokenRefresher, so both tokens are kept fresh independently. Set the
+// audience, resource or requested_token_type with WithOAuthEndpointParams.
+//
+// If the token endpoint rejects the subject token with invalid_request or
+// invalid_grant, a refresh of the subject token is forced and a transient
+// error returned, so that the exchange is retried with the new subject token.
+// If that is rejected too, the error is permanent.
+type TokenExchangeRetriever struct {
+	client           *oauthClient
+	subject          TokenRefresher
+	subjectTokenType string
+
+	mu       sync.Mutex
+	rejected string // The subject token whose rejection forced a refresh.
+}
+
+// NewTokenExchangeRetriever creates a TokenExchangeRetriever that authenticates
+// to tokenURL as clientID, exchanging tokens from subject of subjectTokenType,
+// e.g. TokenTypeIDToken.
+func NewTokenExchangeRetriever(tokenURL, clientID, clientSecret string, subject TokenRefresher, subjectTokenType string, opts ...OAuthOption) *TokenExchangeRetriever {
+	return &TokenExchangeRetriever{
+		client:           newOAuthClient(tokenURL, clientID, clientSecret, opts),
+		subject:          subject,
+		subjectTokenType: subjectTokenType,
+	}
+}
+
+// RetrieveToken implements TokenRetriever.
+func (r *TokenExchangeRetriever) RetrieveToken() (token string, expiresIn time.Duration, err error) {
+	t, expiresIn, err := retrieveContext(context.Background(), r)
+	return t.Value, expiresIn, err
+}
+
+// RetrieveTokenContext implements ContextRetriever.
+func (r *TokenExchangeRetriever) RetrieveTokenContext(ctx context.Context) (Token, error) {
+	subjectToken, err := r.subject.GetToken()
+	if err != nil {
+		// Not wrapped, so that a permanent failure of the subject refresher
+		// doesn't stop this one: it retries until the subject is fixed.
+		return Token{}, fmt.Errorf("token exchange: subject token unavailable: %v", err)
+	}
+
+	res, err := r.client.exchange(ctx, url.Values{
+		"grant_type":         {tokenExchangeGrantType},
+		"subject_token":      {subjectToken},
+		"subject_token_type": {r.subjectTokenType},
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		r.rejected = ""
+		return res.token(), nil
+	}
+
+	var oauthErr *OAuthError
+	if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_request" && oauthErr.Code != "invalid_grant" {
+		return Token{}, err
+	}
+	switch r.rejected {
+	case "":
+		r.rejected = subjectToken
+		r.subject.Refresh("token exchange rejected subject token")
+		return Token{}, oauthErr
+	case subjectToken:
+		return Token{}, oauthErr // The subject hasn't been refreshed yet.
+	}
+	r.rejected = ""
+	return Token{}, err
+}
@@ -0,0 +1,104 @@
+package backoff
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// exchangeEndpoint returns a token exchange endpoint that accepts only
+// validSubject.
+func exchangeEndpoint(t *testing.T, validSubject string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if got := r.PostForm.Get("grant_type"); got != tokenExchangeGrantType {
+			t.Errorf("An unexpected grant type was requested. Want '%v', Got '%v'", tokenExchangeGrantType, got)
+		}
+		if got := r.PostForm.Get("subject_token_type"); got != TokenTypeIDToken {
+			t.Errorf("An unexpected subject token type was sent. Want '%v', Got '%v'", TokenTypeIDToken, got)
+		}
+		if got := r.PostForm.Get("audience"); got != "downstream" {
+			t.Errorf("An unexpected audience was sent. Want '%v', Got '%v'", "downstream", got)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("subject_token") != validSubject {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_request","error_description":"subject token expired"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token":"downstreamToken123","token_type":"Bearer","expires_in":3600,"issued_token_type":"urn:ietf:params:oauth:token-type:access_token"}`))
+	}))
+}
+
+func TestTokenExchangeRetriever(t *testing.T) {
+	t.Parallel()
+
+	// Define expectations.
+	wantToken := "downstreamToken123"
+
+	// Define TokenExchangeRetriever.
+	server := exchangeEndpoint(t, "subjectToken02")
+	defer server.Close()
+	subjectRetriever := mockRetriever{
+		token:          "subjectToken",
+		incrementToken: true,
+		expiresIn:      time.Hour,
+	}
+	subject := NewTokenRefresher(log15.New("global", "backoff_test"), time.Minute, &subjectRetriever)
+	defer subject.Close()
+	time.Sleep(50 * time.Millisecond) // Let the subject retrieve its first token.
+	r := NewTokenExchangeRetriever(server.URL, "client1", "secret", subject, TokenTypeIDToken, WithOAuthEndpointParams(url.Values{"audience": {"downstream"}}))
+
+	// Test the results.
+	_, gotErr := r.RetrieveTokenContext(context.Background()) // subjectToken01 is rejected.
+	if gotErr == nil || IsPermanent(gotErr) {
+		t.Errorf("An unexpected error occurred. Want a transient error, Got '%v'", gotErr)
+	}
+
+	time.Sleep(50 * time.Millisecond) // Let the forced subject refresh happen.
+	gotToken, gotErr := r.RetrieveTokenContext(context.Background())
+	if gotErr != nil {
+		t.Errorf("An unexpected error occurred. Want '%v', Got '%v'", nil, gotErr)
+	}
+	if gotToken.Value != wantToken {
+		t.Errorf("An unexpected token was returned. Want '%v', Got '%v'", wantToken, gotToken.Value)
+	}
+	if gotReason := subject.Status().Reason; gotReason != "token exchange rejected subject token" {
+		t.Errorf("The subject refresh was not forced. Want '%v', Got '%v'", "token exchange rejected subject token", gotReason)
+	}
+}
+
+func TestTokenExchangeRetrieverRejectedTwice(t *testing.T) {
+	t.Parallel()
+
+	// Define TokenExchangeRetriever.
+	server := exchangeEndpoint(t, "")
+	defer server.Close()
+	subjectRetriever := mockRetriever{
+		token:          "subjectToken",
+		incrementToken: true,
+		expiresIn:      time.Hour,
+	}
+	subject := NewTokenRefresher(log15.New("global", "backoff_test"), time.Minute, &subjectRetriever)
+	defer subject.Close()
+	time.Sleep(50 * time.Millisecond) // Let the subject retrieve its first token.
+	r := NewTokenExchangeRetriever(server.URL, "client1", "secret", subject, TokenTypeIDToken, WithOAuthEndpointParams(url.Values{"audience": {"downstream"}}))
+
+	// Test the results.
+	_, gotErr := r.RetrieveTokenContext(context.Background())
+	if gotErr == nil || IsPermanent(gotErr) {
+		t.Errorf("An unexpected error occurred. Want a transient error, Got '%v'", gotErr)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	_, gotErr = r.RetrieveTokenContext(context.Background()) // The refreshed subject token is rejected too.
+	if !IsPermanent(gotErr) {
+		t.Errorf("An unexpected error occurred. Want a permanent error, Got '%v'", gotErr)
+	}
+}